@@ -2,6 +2,7 @@ package lz4_test
 
 import (
 	"bytes"
+	"fmt"
 	"io"
 	"io/ioutil"
 	"testing"
@@ -41,6 +42,23 @@ func BenchmarkCompressRandom(b *testing.B) {
 	}
 }
 
+// benchmarkEstimateRatio should cost a small fraction of the compression
+// of a block, whatever its size.
+func benchmarkEstimateRatio(b *testing.B, size int) {
+	src := pg1661[:size]
+
+	b.SetBytes(int64(size))
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		_ = lz4.EstimateRatio(src)
+	}
+}
+
+func BenchmarkEstimateRatio64K(b *testing.B)  { benchmarkEstimateRatio(b, 64<<10) }
+func BenchmarkEstimateRatio512K(b *testing.B) { benchmarkEstimateRatio(b, 512<<10) }
+
 func BenchmarkCompressHC(b *testing.B) {
 	buf := make([]byte, len(pg1661))
 	c := lz4.CompressorHC{Level: 16}
@@ -56,6 +74,59 @@ func BenchmarkCompressHC(b *testing.B) {
 	}
 }
 
+// benchmarkCompressDict compresses blocks of size bytes with the start of pg1661
+// as dictionary, raw or prepared.
+func benchmarkCompressDict(b *testing.B, size int, prepared bool) {
+	dict, src := pg1661[:64<<10], pg1661[64<<10:]
+	d := lz4.NewDictionary(dict)
+	buf := make([]byte, lz4.CompressBlockBound(size))
+	var c lz4.Compressor
+
+	b.SetBytes(int64(size))
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		off := i * size % (len(src) - size)
+		if prepared {
+			_, _ = c.CompressBlockWithDictionary(src[off:off+size], buf, d)
+		} else {
+			_, _ = c.CompressBlockWithDict(src[off:off+size], buf, dict)
+		}
+	}
+}
+
+func BenchmarkCompressDictRaw1K(b *testing.B)       { benchmarkCompressDict(b, 1<<10, false) }
+func BenchmarkCompressDictPrepared1K(b *testing.B)  { benchmarkCompressDict(b, 1<<10, true) }
+func BenchmarkCompressDictRaw16K(b *testing.B)      { benchmarkCompressDict(b, 16<<10, false) }
+func BenchmarkCompressDictPrepared16K(b *testing.B) { benchmarkCompressDict(b, 16<<10, true) }
+
+// benchmarkCompressHCDict is benchmarkCompressDict for CompressorHC.
+func benchmarkCompressHCDict(b *testing.B, size int, prepared bool) {
+	dict, src := pg1661[:64<<10], pg1661[64<<10:]
+	d := lz4.NewDictionary(dict)
+	buf := make([]byte, lz4.CompressBlockBound(size))
+	c := lz4.CompressorHC{Level: lz4.Level1}
+
+	b.SetBytes(int64(size))
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		off := i * size % (len(src) - size)
+		if prepared {
+			_, _ = c.CompressBlockWithDictionary(src[off:off+size], buf, d)
+		} else {
+			_, _ = c.CompressBlockWithDict(src[off:off+size], buf, dict)
+		}
+	}
+}
+
+func BenchmarkCompressHCDictRaw1K(b *testing.B)       { benchmarkCompressHCDict(b, 1<<10, false) }
+func BenchmarkCompressHCDictPrepared1K(b *testing.B)  { benchmarkCompressHCDict(b, 1<<10, true) }
+func BenchmarkCompressHCDictRaw16K(b *testing.B)      { benchmarkCompressHCDict(b, 16<<10, false) }
+func BenchmarkCompressHCDictPrepared16K(b *testing.B) { benchmarkCompressHCDict(b, 16<<10, true) }
+
 func BenchmarkUncompress(b *testing.B) {
 	buf := make([]byte, len(pg1661))
 
@@ -67,6 +138,35 @@ func BenchmarkUncompress(b *testing.B) {
 	}
 }
 
+// BenchmarkUncompressHC compares the decompression speed of blocks compressed
+// with and without favoring decompression speed.
+func BenchmarkUncompressHC(b *testing.B) {
+	for _, level := range []lz4.CompressionLevel{lz4.Level10, lz4.Level12} {
+		for _, favor := range []bool{false, true} {
+			c := lz4.CompressorHC{Level: level, FavorDecSpeed: favor}
+			zbuf := make([]byte, lz4.CompressBlockBound(len(pg1661)))
+			n, err := c.CompressBlock(pg1661, zbuf)
+			if err != nil {
+				b.Fatal(err)
+			}
+			zbuf = zbuf[:n]
+
+			b.Run(fmt.Sprintf("%s/favor=%v", level, favor), func(b *testing.B) {
+				buf := make([]byte, len(pg1661))
+
+				b.SetBytes(int64(len(pg1661)))
+				b.ReportAllocs()
+				b.ResetTimer()
+				b.ReportMetric(float64(len(zbuf)), "inbytes")
+
+				for i := 0; i < b.N; i++ {
+					_, _ = lz4block.UncompressBlock(zbuf, buf, nil)
+				}
+			})
+		}
+	}
+}
+
 func mustLoadFile(f string) []byte {
 	b, err := ioutil.ReadFile(f)
 	if err != nil {
@@ -3,7 +3,9 @@ package main
 import (
 	"flag"
 	"fmt"
+	"hash/crc32"
 	"io"
+	"io/ioutil"
 	"os"
 	"sync/atomic"
 
@@ -23,37 +25,45 @@ func Compress(fs *flag.FlagSet) cmdflag.Handler {
 	var streamChecksum bool
 	fs.BoolVar(&streamChecksum, "sc", false, "disable stream checksum")
 	var level uint
-	fs.UintVar(&level, "l", 0, "compression level (0=fastest)")
+	fs.UintVar(&level, "l", 0, "compression level (0=fastest, 10-12=optimal parsing)")
 	var concurrency int
 	fs.IntVar(&concurrency, "c", -1, "concurrency (default=all CPUs")
-
-	var lvl lz4.CompressionLevel
-	switch level {
-	default:
-		fallthrough
-	case 0:
-		lvl = lz4.Fast
-	case 1:
-		lvl = lz4.Level1
-	case 2:
-		lvl = lz4.Level2
-	case 3:
-		lvl = lz4.Level3
-	case 4:
-		lvl = lz4.Level4
-	case 5:
-		lvl = lz4.Level5
-	case 6:
-		lvl = lz4.Level6
-	case 7:
-		lvl = lz4.Level7
-	case 8:
-		lvl = lz4.Level8
-	case 9:
-		lvl = lz4.Level9
-	}
+	var dictFile string
+	fs.StringVar(&dictFile, "D", "", "use the dictionary file")
 
 	return func(args ...string) (int, error) {
+		var lvl lz4.CompressionLevel
+		switch level {
+		default:
+			fallthrough
+		case 0:
+			lvl = lz4.Fast
+		case 1:
+			lvl = lz4.Level1
+		case 2:
+			lvl = lz4.Level2
+		case 3:
+			lvl = lz4.Level3
+		case 4:
+			lvl = lz4.Level4
+		case 5:
+			lvl = lz4.Level5
+		case 6:
+			lvl = lz4.Level6
+		case 7:
+			lvl = lz4.Level7
+		case 8:
+			lvl = lz4.Level8
+		case 9:
+			lvl = lz4.Level9
+		case 10:
+			lvl = lz4.Level10
+		case 11:
+			lvl = lz4.Level11
+		case 12:
+			lvl = lz4.Level12
+		}
+
 		sz, err := bytefmt.ToBytes(blockMaxSize)
 		if err != nil {
 			return 0, err
@@ -67,6 +77,14 @@ func Compress(fs *flag.FlagSet) cmdflag.Handler {
 			lz4.CompressionLevelOption(lvl),
 			lz4.ConcurrencyOption(concurrency),
 		}
+		if dictFile != "" {
+			dict, err := ioutil.ReadFile(dictFile)
+			if err != nil {
+				return 0, err
+			}
+			// Identify the dictionary by its checksum.
+			options = append(options, lz4.DictionaryOption(crc32.ChecksumIEEE(dict), dict))
+		}
 		if err := zw.Apply(options...); err != nil {
 			return 0, err
 		}
@@ -27,6 +27,20 @@ func main() {
 		Err:   flag.ExitOnError,
 		Init:  Uncompress,
 	})
+	cli.MustAdd(cmdflag.Application{
+		Name:  "stats",
+		Args:  "[arguments] [<file name> ...]",
+		Descr: "Print statistics about the sequences of the blocks of the given LZ4 files or from stdin.",
+		Err:   flag.ExitOnError,
+		Init:  Stats,
+	})
+	cli.MustAdd(cmdflag.Application{
+		Name:  "train",
+		Args:  "[arguments] [<file name> ...]",
+		Descr: "Train a dictionary from the given sample files or from stdin.",
+		Err:   flag.ExitOnError,
+		Init:  Train,
+	})
 
 	if err := cli.Parse(); err != nil {
 		fmt.Println(err)
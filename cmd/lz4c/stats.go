@@ -0,0 +1,157 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math/bits"
+	"os"
+
+	"github.com/pierrec/cmdflag"
+	"github.com/pierrec/lz4/v4"
+)
+
+// Stats prints statistics about the sequences of LZ4 blocks, from files or stdin.
+func Stats(fs *flag.FlagSet) cmdflag.Handler {
+	var block bool
+	fs.BoolVar(&block, "block", false, "input is a single LZ4 block instead of LZ4 frames")
+	var verbose bool
+	fs.BoolVar(&verbose, "v", false, "print every sequence")
+	var dictFile string
+	fs.StringVar(&dictFile, "D", "", "use the dictionary file")
+
+	return func(args ...string) (int, error) {
+		zr := lz4.NewReader(nil)
+		if dictFile != "" {
+			resolver, err := dictionaryResolver(dictFile)
+			if err != nil {
+				return 0, err
+			}
+			if err := zr.Apply(resolver); err != nil {
+				return 0, err
+			}
+		}
+		stats := func(name string, r io.Reader) error {
+			st := &seqStats{verbose: verbose}
+			var err error
+			if block {
+				// A block cannot be scanned before it is complete.
+				var data []byte
+				if data, err = ioutil.ReadAll(r); err == nil {
+					err = st.addBlock(data, false, nil)
+				}
+			} else {
+				zr.Reset(r)
+				if err = zr.Apply(lz4.OnBlockOption(st.addBlock)); err == nil {
+					_, err = io.Copy(ioutil.Discard, zr)
+				}
+			}
+			if err != nil {
+				return fmt.Errorf("%s: %w", name, err)
+			}
+			st.print(os.Stdout, name)
+			return nil
+		}
+
+		// Use stdin if no file provided.
+		if len(args) == 0 {
+			return 0, stats("<stdin>", os.Stdin)
+		}
+
+		for fidx, filename := range args {
+			file, err := os.Open(filename)
+			if err != nil {
+				return fidx, err
+			}
+			err = stats(filename, file)
+			_ = file.Close()
+			if err != nil {
+				return fidx, err
+			}
+		}
+		return len(args), nil
+	}
+}
+
+// seqStats accumulates the statistics of a set of blocks.
+type seqStats struct {
+	verbose bool
+
+	blocks, stored         int
+	sequences              int
+	compressed, size       int
+	literals, matches      int
+	offsets, matchLens     [33]int // histograms by bit length
+	literalRuns            [33]int
+	maxOffset, maxMatchLen int
+}
+
+// addBlock adds the sequences of a block to the statistics.
+// Matches may reference dict, the data preceding the block.
+func (st *seqStats) addBlock(block []byte, stored bool, dict []byte) error {
+	st.blocks++
+	st.compressed += len(block)
+	if stored {
+		st.stored++
+		st.size += len(block)
+		return nil
+	}
+
+	s := lz4.NewSequenceScanner(block, len(dict))
+	for s.Scan() {
+		seq := s.Sequence()
+		if st.verbose {
+			fmt.Printf("block %d sequence %d: literals=%d offset=%d match=%d\n",
+				st.blocks, st.sequences, len(seq.Literals), seq.Offset, seq.MatchLen)
+		}
+		st.sequences++
+		st.literals += len(seq.Literals)
+		st.matches += seq.MatchLen
+		st.literalRuns[bits.Len(uint(len(seq.Literals)))]++
+		if seq.MatchLen > 0 {
+			st.offsets[bits.Len(uint(seq.Offset))]++
+			st.matchLens[bits.Len(uint(seq.MatchLen))]++
+			if seq.Offset > st.maxOffset {
+				st.maxOffset = seq.Offset
+			}
+			if seq.MatchLen > st.maxMatchLen {
+				st.maxMatchLen = seq.MatchLen
+			}
+		}
+	}
+	if err := s.Err(); err != nil {
+		return fmt.Errorf("block %d: %w", st.blocks, err)
+	}
+	st.size += s.UncompressedSize()
+	return nil
+}
+
+func (st *seqStats) print(w io.Writer, name string) {
+	ratio := 0.0
+	if st.size > 0 {
+		ratio = float64(st.compressed) * 100 / float64(st.size)
+	}
+	fmt.Fprintf(w, "%s: %d blocks (%d stored), %d sequences\n", name, st.blocks, st.stored, st.sequences)
+	fmt.Fprintf(w, "  compressed %d bytes, uncompressed %d bytes (%.02f%%)\n", st.compressed, st.size, ratio)
+	fmt.Fprintf(w, "  literals %d bytes, matches %d bytes\n", st.literals, st.matches)
+	printHistogram(w, "literal runs", st.literalRuns[:])
+	printHistogram(w, fmt.Sprintf("match offsets (max %d)", st.maxOffset), st.offsets[:])
+	printHistogram(w, fmt.Sprintf("match lengths (max %d)", st.maxMatchLen), st.matchLens[:])
+}
+
+// printHistogram prints the non empty buckets of h, where h[i] counts the values
+// of bit length i.
+func printHistogram(w io.Writer, title string, h []int) {
+	fmt.Fprintf(w, "  %s:\n", title)
+	for i, n := range h {
+		if n == 0 {
+			continue
+		}
+		if i == 0 {
+			fmt.Fprintf(w, "    %-18s %d\n", "0", n)
+			continue
+		}
+		fmt.Fprintf(w, "    %-18s %d\n", fmt.Sprintf("[%d, %d)", 1<<(i-1), 1<<i), n)
+	}
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+
+	"code.cloudfoundry.org/bytefmt"
+
+	"github.com/pierrec/cmdflag"
+	"github.com/pierrec/lz4/v4"
+)
+
+// Train builds a dictionary from a set of sample files or from stdin.
+func Train(fs *flag.FlagSet) cmdflag.Handler {
+	var output string
+	fs.StringVar(&output, "o", "dictionary", "dictionary file name")
+	var dictSize string
+	fs.StringVar(&dictSize, "size", "64K", "dictionary max size (up to 64K)")
+	var split string
+	fs.StringVar(&split, "split", "", "split the input into samples of that size (default=one sample per file)")
+
+	return func(args ...string) (int, error) {
+		size, err := bytefmt.ToBytes(dictSize)
+		if err != nil {
+			return 0, err
+		}
+		var splitSize uint64
+		if split != "" {
+			if splitSize, err = bytefmt.ToBytes(split); err != nil {
+				return 0, err
+			}
+		}
+
+		var samples [][]byte
+		add := func(data []byte) {
+			if splitSize == 0 {
+				samples = append(samples, data)
+				return
+			}
+			for uint64(len(data)) > splitSize {
+				samples = append(samples, data[:splitSize])
+				data = data[splitSize:]
+			}
+			if len(data) > 0 {
+				samples = append(samples, data)
+			}
+		}
+
+		// Use stdin if no file provided.
+		if len(args) == 0 {
+			data, err := ioutil.ReadAll(os.Stdin)
+			if err != nil {
+				return 0, err
+			}
+			add(data)
+		}
+		for fidx, filename := range args {
+			data, err := ioutil.ReadFile(filename)
+			if err != nil {
+				return fidx, err
+			}
+			add(data)
+		}
+
+		dict := lz4.TrainDictionary(samples, int(size))
+		if err := ioutil.WriteFile(output, dict, 0644); err != nil {
+			return len(args), err
+		}
+		fmt.Printf("%s: %d bytes from %d samples\n", output, len(dict), len(samples))
+
+		return len(args), nil
+	}
+}
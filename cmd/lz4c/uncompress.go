@@ -3,7 +3,9 @@ package main
 import (
 	"flag"
 	"fmt"
+	"hash/crc32"
 	"io"
+	"io/ioutil"
 	"os"
 	"strings"
 
@@ -14,9 +16,21 @@ import (
 )
 
 // Uncompress uncompresses a set of files or from stdin to stdout.
-func Uncompress(_ *flag.FlagSet) cmdflag.Handler {
+func Uncompress(fs *flag.FlagSet) cmdflag.Handler {
+	var dictFile string
+	fs.StringVar(&dictFile, "D", "", "use the dictionary file")
+
 	return func(args ...string) (int, error) {
 		zr := lz4.NewReader(nil)
+		if dictFile != "" {
+			resolver, err := dictionaryResolver(dictFile)
+			if err != nil {
+				return 0, err
+			}
+			if err := zr.Apply(resolver); err != nil {
+				return 0, err
+			}
+		}
 
 		// Use stdin/stdout if no file provided.
 		if len(args) == 0 {
@@ -92,3 +106,19 @@ func Uncompress(_ *flag.FlagSet) cmdflag.Handler {
 		return len(args), nil
 	}
 }
+
+// dictionaryResolver returns the option resolving the frame dictionaries to the content of dictFile,
+// which is identified by its checksum as done by Compress.
+func dictionaryResolver(dictFile string) (lz4.Option, error) {
+	dict, err := ioutil.ReadFile(dictFile)
+	if err != nil {
+		return nil, err
+	}
+	id := crc32.ChecksumIEEE(dict)
+	return lz4.DictionaryResolverOption(func(fid uint32) ([]byte, error) {
+		if fid != id {
+			return nil, fmt.Errorf("dictionary %s does not match the frame dictionary ID %#x", dictFile, fid)
+		}
+		return dict, nil
+	}), nil
+}
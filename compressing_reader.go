@@ -21,11 +21,13 @@ const (
 type CompressingReader struct {
 	state crState
 	src io.ReadCloser // source reader
-	level lz4block.CompressionLevel // how hard to try
+	params lz4block.Params // how to compress
 	frame *lz4stream.Frame // frame being built
 	in []byte
 	out ovWriter
 	handler func(int)
+	stream lz4block.LinkedCompressor // compressor of dependent blocks
+	dict *lz4block.Dict // dictionary identified in the frame descriptor
 }
 
 // NewCompressingReader creates a reader which reads compressed data from
@@ -37,7 +39,7 @@ func NewCompressingReader(src io.ReadCloser) *CompressingReader {
 		frame: lz4stream.NewFrame(),
 	}
 
-	_ = zrd.Apply(DefaultBlockSizeOption, DefaultChecksumOption, defaultOnBlockDone)
+	_ = zrd.Apply(DefaultBlockSizeOption, DefaultChecksumOption, defaultOnBlockDone, defaultIndependence)
 	zrd.Reset(src)
 
 	return zrd
@@ -75,6 +77,14 @@ func (*CompressingReader) private() {}
 
 func (zrd *CompressingReader) init() error {
 	zrd.frame.InitW(&zrd.out, 1, false)
+	if !zrd.frame.Descriptor.Flags.BlockIndependence() {
+		// The dictionary precedes the first block.
+		var dict []byte
+		if zrd.dict != nil {
+			dict = zrd.dict.Bytes()
+		}
+		zrd.stream.Reset(zrd.params, dict)
+	}
 	size := zrd.frame.Descriptor.Flags.BlockSizeIndex()
 	zrd.in = size.Get()
 	return zrd.frame.Descriptor.Write(zrd.frame, &zrd.out)
@@ -120,9 +130,7 @@ func (zrd *CompressingReader) Read(p []byte) (n int, err error) {
 		rCount, err = io.ReadFull(zrd.src, zrd.in)
 		switch err {
 		case nil:
-			err = block.Compress(
-				zrd.frame, zrd.in[ : rCount], zrd.level,
-			).Write(zrd.frame, &zrd.out)
+			err = zrd.compress(block, zrd.in[ : rCount])
 			zrd.handler(len(block.Data))
 			if err != nil {
 				return
@@ -136,9 +144,7 @@ func (zrd *CompressingReader) Read(p []byte) (n int, err error) {
 			}
 		case io.EOF, io.ErrUnexpectedEOF: // read may be partial
 			if rCount > 0 {
-				err = block.Compress(
-					zrd.frame, zrd.in[ : rCount], zrd.level,
-				).Write(zrd.frame, &zrd.out)
+				err = zrd.compress(block, zrd.in[ : rCount])
 				zrd.handler(len(block.Data))
 				if err != nil {
 					return
@@ -164,6 +170,21 @@ func (zrd *CompressingReader) Read(p []byte) (n int, err error) {
 	return
 }
 
+// compress compresses data into block and writes it to the output.
+func (zrd *CompressingReader) compress(block *lz4stream.FrameDataBlock, data []byte) error {
+	if zrd.frame.Descriptor.Flags.BlockIndependence() {
+		// Every block is compressed with the prepared dictionary, if any.
+		block.CompressWith(zrd.frame, data, func(src, dst []byte) (int, error) {
+			return zrd.params.CompressBlockWithPreparedDict(src, dst, zrd.dict)
+		})
+	} else {
+		block.CompressWith(zrd.frame, data, func(src, dst []byte) (int, error) {
+			return zrd.stream.CompressBlock(src, dst, zrd.params.Store)
+		})
+	}
+	return block.Write(zrd.frame, &zrd.out)
+}
+
 // Reset makes the stream usable again; mostly handy to reuse lz4 encoder
 // instances.
 func (zrd *CompressingReader) Reset(src io.ReadCloser) {
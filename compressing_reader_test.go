@@ -27,6 +27,7 @@ func TestCompressingReader(t *testing.T) {
 		for _, option := range []lz4.Option{
 			lz4.BlockChecksumOption(true),
 			lz4.SizeOption(123),
+			lz4.BlockIndependenceOption(false),
 		} {
 			label := fmt.Sprintf("%s/%s", fname, option)
 			t.Run(label, func(t *testing.T) {
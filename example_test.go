@@ -60,3 +60,31 @@ func ExampleCompressBlock() {
 	// Output:
 	// hello world
 }
+
+func ExampleSequenceScanner() {
+	data := []byte(strings.Repeat("hello world ", 100))
+	buf := make([]byte, lz4.CompressBlockBound(len(data)))
+
+	var c lz4.Compressor
+	n, err := c.CompressBlock(data, buf)
+	if err != nil {
+		fmt.Println(err)
+	}
+	buf = buf[:n] // compressed data
+
+	s := lz4.NewSequenceScanner(buf, 0)
+	for s.Scan() {
+		seq := s.Sequence()
+		fmt.Printf("literals=%q offset=%d match=%d\n", seq.Literals, seq.Offset, seq.MatchLen)
+	}
+	if err := s.Err(); err != nil {
+		fmt.Println(err)
+	}
+	fmt.Println("uncompressed size:", s.UncompressedSize())
+
+	// Output:
+	// literals="hello world " offset=12 match=1172
+	// literals="" offset=1176 match=4
+	// literals="hello world " offset=0 match=0
+	// uncompressed size: 1200
+}
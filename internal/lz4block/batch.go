@@ -0,0 +1,102 @@
+package lz4block
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+
+	"github.com/pierrec/lz4/v4/internal/lz4errors"
+)
+
+// CompressBlocks compresses every src[i] into dst[i] and sets dst[i] to the compressed data,
+// using at most workers goroutines, each of them with its own pooled compressor.
+// It returns the error of the first block that failed.
+func (p Params) CompressBlocks(dst, src [][]byte, workers int) error {
+	if err := checkCount(dst, src); err != nil {
+		return err
+	}
+	return parallel(len(src), workers, func() (func(int) error, func()) {
+		compress, release := p.compressor()
+		return func(i int) error {
+			n, err := compress(src[i], dst[i], nil)
+			dst[i] = dst[i][:n]
+			return err
+		}, release
+	})
+}
+
+// UncompressBlocks uncompresses every src[i] into dst[i] and sets dst[i] to the uncompressed data,
+// using at most workers goroutines.
+// It returns the error of the first block that failed.
+func UncompressBlocks(dst, src [][]byte, workers int) error {
+	if err := checkCount(dst, src); err != nil {
+		return err
+	}
+	return parallel(len(src), workers, func() (func(int) error, func()) {
+		return func(i int) error {
+			n, err := UncompressBlock(src[i], dst[i], nil)
+			dst[i] = dst[i][:n]
+			return err
+		}, func() {}
+	})
+}
+
+// checkCount returns an error if there are fewer destination buffers than blocks.
+func checkCount(dst, src [][]byte) error {
+	if len(dst) < len(src) {
+		return fmt.Errorf("%w: %d destination buffers for %d blocks",
+			lz4errors.ErrInvalidSourceShortBuffer, len(dst), len(src))
+	}
+	return nil
+}
+
+// parallel runs the tasks [0, n) in order on at most workers goroutines.
+// Each goroutine gets its task function and a function releasing its resources from newWorker.
+// Once a task fails, no more tasks are started, and the error of the failed task
+// with the lowest index is returned.
+func parallel(n, workers int, newWorker func() (task func(int) error, release func())) error {
+	if workers > n {
+		workers = n
+	}
+	if workers < 1 {
+		workers = 1
+	}
+
+	var (
+		next   int64 = -1 // last task started
+		failed int32
+		mu     sync.Mutex
+		errIdx = n
+		err    error
+	)
+	run := func() {
+		task, release := newWorker()
+		defer release()
+		for atomic.LoadInt32(&failed) == 0 {
+			i := int(atomic.AddInt64(&next, 1))
+			if i >= n {
+				return
+			}
+			if e := task(i); e != nil {
+				atomic.StoreInt32(&failed, 1)
+				mu.Lock()
+				if i < errIdx {
+					errIdx, err = i, fmt.Errorf("block %d: %w", i, e)
+				}
+				mu.Unlock()
+			}
+		}
+	}
+
+	var wg sync.WaitGroup
+	wg.Add(workers - 1)
+	for w := 1; w < workers; w++ {
+		go func() {
+			defer wg.Done()
+			run()
+		}()
+	}
+	run()
+	wg.Wait()
+	return err
+}
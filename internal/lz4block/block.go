@@ -15,14 +15,24 @@ const (
 	winSize    = 1 << winSizeLog
 	winMask    = winSize - 1 // 64Kb window of previous data for dependent blocks
 
-	// hashLog determines the size of the hash table used to quickly find a previous match position.
+	// hashLog determines the default size of the hash table used to quickly find a previous match position.
 	// Its value influences the compression speed and memory usage, the lower the faster,
 	// but at the expense of the compression ratio.
 	// 16 seems to be the best compromise for fast compression.
 	hashLog = 16
 	htSize  = 1 << hashLog
 
+	// MinHashLog and MaxHashLog bound the hash table size of the fast compressor.
+	MinHashLog = 8
+	MaxHashLog = 20
+
+	// MaxOffset is the largest match offset allowed by the LZ4 format.
+	MaxOffset = winSize - 1
+
 	mfLimit = 10 + minMatch // The last match cannot start within the last 14 bytes.
+
+	// maxAcceleration bounds the acceleration of the fast compressor.
+	maxAcceleration = 65537
 )
 
 func recoverBlock(e *error) {
@@ -31,8 +41,8 @@ func recoverBlock(e *error) {
 	}
 }
 
-// blockHash hashes the lower 6 bytes into a value < htSize.
-func blockHash(x uint64) uint32 {
+// blockHash hashes the lower 6 bytes into a value < 1<<hashLog.
+func blockHash(x uint64, hashLog uint) uint32 {
 	const prime6bytes = 227718039650203
 	return uint32(((x << (64 - 48)) * prime6bytes) >> (64 - hashLog))
 }
@@ -48,10 +58,109 @@ func UncompressBlock(src, dst, dict []byte) (int, error) {
 	if di := decodeBlock(dst, src, dict); di >= 0 {
 		return di, nil
 	}
+	return 0, decodeError(src, len(dst), len(dict))
+}
+
+// inPlaceMargin is the constant part of InPlaceMargin.
+//
+// When uncompressing in place, the gap between the input and output positions
+// at the start of a sequence is at least the gap at the end of the block, minus
+// the expansion of the rest of the block: 2 bytes for the last sequence, and
+// 1 byte per 255 literals in a run, which is at most 1/256 of the compressed size.
+// Within a sequence, the gap is at least the one at the start of the sequence
+// or of the next one.
+// Besides exact copies, the decoders write at most 48 bytes past the output
+// position, so that they never overwrite input not yet read.
+const inPlaceMargin = 64
+
+// InPlaceMargin returns the number of bytes required after the uncompressed data
+// by UncompressInPlace for a block of compressedSize bytes.
+func InPlaceMargin(compressedSize int) int {
+	return compressedSize>>8 + inPlaceMargin
+}
+
+// UncompressInPlace uncompresses the block at buf[compressedOffset:] into buf.
+// The uncompressed data must leave at least InPlaceMargin bytes at the end of buf.
+// As the block is overwritten while it is decoded, failures to do so are not
+// detailed and reported as ErrInvalidSourceShortBuffer.
+func UncompressInPlace(buf []byte, compressedOffset int) (int, error) {
+	if compressedOffset < 0 || compressedOffset > len(buf) {
+		return 0, lz4errors.ErrInvalidSourceShortBuffer
+	}
+	src := buf[compressedOffset:]
+	if len(src) == 0 {
+		return 0, nil
+	}
+	n := len(buf) - InPlaceMargin(len(src))
+	if n < 0 {
+		return 0, lz4errors.ErrInvalidSourceShortBuffer
+	}
+	if di := decodeBlock(buf[:n], src, nil); di >= 0 {
+		return di, nil
+	}
 	return 0, lz4errors.ErrInvalidSourceShortBuffer
 }
 
+// UncompressBlockPartial uncompresses src into dst until targetSize bytes are produced
+// or the block ends, and returns the number of bytes written.
+// The rest of src is not validated.
+func UncompressBlockPartial(src, dst, dict []byte, targetSize int) (int, error) {
+	if targetSize > len(dst) {
+		targetSize = len(dst)
+	}
+	if len(src) == 0 || targetSize <= 0 {
+		return 0, nil
+	}
+	return uncompressPartial(src, dst, dict, targetSize)
+}
+
+// UncompressBlockSized uncompresses the block at the start of src, whose uncompressed
+// size is len(dst), into dst. It returns the number of bytes written to dst and read from src.
+func UncompressBlockSized(src, dst, dict []byte) (int, int, error) {
+	si, err := blockSize(src, len(dst))
+	if err != nil {
+		return 0, 0, err
+	}
+	if decodeBlock(dst, src[:si], dict) != len(dst) {
+		return 0, 0, decodeError(src[:si], len(dst), len(dict))
+	}
+	return len(dst), si, nil
+}
+
+// UncompressedSize validates src and returns its uncompressed size.
+// Matches may reference up to dictLen bytes before the block.
+func UncompressedSize(src []byte, dictLen int) (int, error) {
+	s := NewSequenceScanner(src, dictLen)
+	for s.Scan() {
+	}
+	return s.UncompressedLen(), s.Err()
+}
+
+// AppendUncompressed appends the uncompressed src to dst, growing it as needed.
+func AppendUncompressed(dst, src, dict []byte) ([]byte, error) {
+	n, err := UncompressedSize(src, len(dict))
+	if err != nil || n == 0 {
+		return dst, err
+	}
+	di := len(dst)
+	dst = append(dst, make([]byte, n)...)
+	if decodeBlock(dst[di:], src, dict) != n {
+		return dst[:di], decodeError(src, n, len(dict))
+	}
+	return dst, nil
+}
+
 type Compressor struct {
+	// Acceleration trades compression ratio for speed: the higher the faster.
+	// Values < 1 mean 1.
+	Acceleration int
+	// HashLog is the base 2 logarithm of the number of hash table entries.
+	// Values < 1 mean 16, others are capped to [MinHashLog, MaxHashLog].
+	HashLog int
+	// MaxOffset is the largest match offset, for decoders with a smaller window.
+	// Values < 1 or > MaxOffset mean MaxOffset.
+	MaxOffset int
+
 	// Offsets are at most 64kiB, so we can store only the lower 16 bits of
 	// match positions: effectively, an offset from some 64kiB block boundary.
 	//
@@ -60,21 +169,39 @@ type Compressor struct {
 	// depending on which of these is inside the current window. If a table
 	// entry was generated more than 64kiB back in the input, we find out by
 	// inspecting the input stream.
+	//
+	// Smaller tables only use the start of table.
 	table [htSize]uint16
 
 	// Bitmap indicating which positions in the table are in use.
 	// This allows us to quickly reset the table for reuse,
 	// without having to zero everything.
 	inUse [htSize / 32]uint32
+
+	// Table and bitmap used instead of the above when it is too small for HashLog.
+	bigTable []uint16
+	bigInUse []uint32
+
+	// Size of the table, set by reset.
+	hashLog uint
+
+	// Scratch buffer holding a dictionary followed by the data to compress.
+	buf []byte
+	// Prepared dictionary whose table was loaded last, if any.
+	// It only differs from its table at the positions of the data in buf.
+	dict *Dict
 }
 
 // Get returns the position of a presumptive match for the hash h.
 // The match may be a false positive due to a hash collision or an old entry.
 // If si < winSize, the return value may be negative.
 func (c *Compressor) get(h uint32, si int) int {
-	h &= htSize - 1
 	i := 0
-	if c.inUse[h/32]&(1<<(h%32)) != 0 {
+	if c.bigTable != nil {
+		if c.bigInUse[h/32]&(1<<(h%32)) != 0 {
+			i = int(c.bigTable[h])
+		}
+	} else if h &= htSize - 1; c.inUse[h/32]&(1<<(h%32)) != 0 {
 		i = int(c.table[h])
 	}
 	i += si &^ winMask
@@ -86,39 +213,278 @@ func (c *Compressor) get(h uint32, si int) int {
 }
 
 func (c *Compressor) put(h uint32, si int) {
+	if c.bigTable != nil {
+		c.bigTable[h] = uint16(si)
+		c.bigInUse[h/32] |= 1 << (h % 32)
+		return
+	}
 	h &= htSize - 1
 	c.table[h] = uint16(si)
 	c.inUse[h/32] |= 1 << (h % 32)
 }
 
-func (c *Compressor) reset() { c.inUse = [htSize / 32]uint32{} }
+// tables returns the parts of the hash table and bitmap used with the current HashLog.
+func (c *Compressor) tables() ([]uint16, []uint32) {
+	if c.bigTable != nil {
+		return c.bigTable, c.bigInUse
+	}
+	return c.table[:1<<c.hashLog], c.inUse[:1<<c.hashLog/32]
+}
+
+// reset empties the hash table, resizing it if HashLog has changed.
+func (c *Compressor) reset() {
+	c.dict = nil
+	c.hashLog = hashLogOf(c.HashLog)
+	switch {
+	case c.hashLog <= hashLog:
+		c.bigTable, c.bigInUse = nil, nil
+	case len(c.bigTable) != 1<<c.hashLog:
+		c.bigTable = make([]uint16, 1<<c.hashLog)
+		c.bigInUse = make([]uint32, 1<<c.hashLog/32)
+		return
+	}
+	_, inUse := c.tables()
+	for i := range inUse {
+		inUse[i] = 0
+	}
+}
 
-var compressorPool = sync.Pool{New: func() interface{} { return new(Compressor) }}
+// hashLogOf returns the hash table size to be used for the given HashLog.
+func hashLogOf(n int) uint {
+	switch {
+	case n < 1:
+		return hashLog
+	case n < MinHashLog:
+		return MinHashLog
+	case n > MaxHashLog:
+		return MaxHashLog
+	}
+	return uint(n)
+}
+
+// maxOffsetOf returns the largest match offset to be used for the given MaxOffset.
+func maxOffsetOf(n int) int {
+	if n < 1 || n > MaxOffset {
+		return MaxOffset
+	}
+	return n
+}
+
+// index adds the positions of src[start:end] to the hash table.
+func (c *Compressor) index(src []byte, start, end int) {
+	for si := start; si+8 <= end; si++ {
+		c.put(blockHash(binary.LittleEndian.Uint64(src[si:]), c.hashLog), si)
+	}
+}
+
+// compressorPools holds Compressors by hash table size.
+var compressorPools [MaxHashLog + 1]sync.Pool
 
 func CompressBlock(src, dst []byte) (int, error) {
-	c := compressorPool.Get().(*Compressor)
-	n, err := c.CompressBlock(src, dst)
-	compressorPool.Put(c)
+	return Params{}.CompressBlock(src, dst)
+}
+
+// Params defines how blocks are compressed by the frame writers.
+type Params struct {
+	Level         CompressionLevel
+	Acceleration  int // only used by the Fast level
+	HashLog       int // only used by the Fast level
+	MaxOffset     int
+	FavorDecSpeed bool // only used from Level10
+	Store         bool // encode the blocks as literals only, whatever the level
+}
+
+// CompressBlock compresses src into dst using pooled compressors.
+func (p Params) CompressBlock(src, dst []byte) (int, error) {
+	return p.CompressBlockWithDict(src, dst, nil)
+}
+
+// CompressBlockWithDict is like CompressBlock but matches may also reference dict.
+func (p Params) CompressBlockWithDict(src, dst, dict []byte) (int, error) {
+	compress, release := p.compressor()
+	n, err := compress(src, dst, dict)
+	release()
 	return n, err
 }
 
+// CompressBlockWithPreparedDict is like CompressBlockWithDict but uses the tables prepared in d.
+// A nil d means no dictionary.
+func (p Params) CompressBlockWithPreparedDict(src, dst []byte, d *Dict) (int, error) {
+	switch {
+	case d == nil:
+		return p.CompressBlock(src, dst)
+	case p.Store:
+		return storeBlock(src, dst)
+	case p.Level != Fast:
+		c := p.compressorHC()
+		defer compressorHCPool.Put(c)
+		return c.CompressBlockWithPreparedDict(src, dst, d, p.Level)
+	}
+	c, pool := p.fastCompressor()
+	defer pool.Put(c)
+	return c.CompressBlockWithPreparedDict(src, dst, d)
+}
+
+// compressor returns the compression function of a pooled compressor set up with p,
+// and the function returning the compressor to its pool.
+func (p Params) compressor() (compress func(src, dst, dict []byte) (int, error), release func()) {
+	if p.Store {
+		compress = func(src, dst, _ []byte) (int, error) { return storeBlock(src, dst) }
+		return compress, func() {}
+	}
+	if p.Level != Fast {
+		c := p.compressorHC()
+		compress = func(src, dst, dict []byte) (int, error) { return c.CompressBlockWithDict(src, dst, dict, p.Level) }
+		return compress, func() { compressorHCPool.Put(c) }
+	}
+	c, pool := p.fastCompressor()
+	return c.CompressBlockWithDict, func() { pool.Put(c) }
+}
+
+// fastCompressor returns a pooled Compressor set up with p, and its pool.
+func (p Params) fastCompressor() (*Compressor, *sync.Pool) {
+	pool := &compressorPools[hashLogOf(p.HashLog)]
+	c, _ := pool.Get().(*Compressor)
+	if c == nil {
+		c = new(Compressor)
+	}
+	c.Acceleration = p.Acceleration
+	c.HashLog = p.HashLog
+	c.MaxOffset = p.MaxOffset
+	return c, pool
+}
+
+// compressorHC returns a pooled CompressorHC set up with p.
+func (p Params) compressorHC() *CompressorHC {
+	c := compressorHCPool.Get().(*CompressorHC)
+	c.MaxOffset = p.MaxOffset
+	c.FavorDecSpeed = p.FavorDecSpeed
+	return c
+}
+
+// storeBlock encodes src into dst as a single run of literals.
+// It returns 0 if dst is too small, so that the block is stored uncompressed.
+func storeBlock(src, dst []byte) (int, error) {
+	n := len(src)
+	size := 1 + n
+	if n >= 0xF {
+		size += (n-0xF)/0xFF + 1
+	}
+	if len(dst) < size {
+		return 0, nil
+	}
+	di := 1
+	if n < 0xF {
+		dst[0] = byte(n << 4)
+	} else {
+		dst[0] = 0xF0
+		for n -= 0xF; n >= 0xFF; n -= 0xFF {
+			dst[di] = 0xFF
+			di++
+		}
+		dst[di] = byte(n)
+		di++
+	}
+	return di + copy(dst[di:], src), nil
+}
+
 func (c *Compressor) CompressBlock(src, dst []byte) (int, error) {
 	// Zero out reused table to avoid non-deterministic output (issue #65).
 	c.reset()
+	return c.compress(src, 0, dst)
+}
+
+// CompressBlockWithDict is like CompressBlock but matches may also reference dict.
+func (c *Compressor) CompressBlockWithDict(src, dst, dict []byte) (int, error) {
+	c.reset()
+	if len(dict) == 0 {
+		return c.compress(src, 0, dst)
+	}
+	dict = trimDict(dict)
+	c.buf = join(c.buf, dict, src)
+	c.index(c.buf, 0, len(dict))
+	return c.compress(c.buf, len(dict), dst)
+}
+
+// CompressBlockWithPreparedDict is like CompressBlockWithDict but uses
+// the hash table precomputed in d if it has the same size.
+func (c *Compressor) CompressBlockWithPreparedDict(src, dst []byte, d *Dict) (int, error) {
+	if len(d.data) == 0 {
+		return c.CompressBlock(src, dst)
+	}
+	n := len(d.data)
+	switch t := d.fastTable(); {
+	case t.hashLog != hashLogOf(c.HashLog):
+		c.reset()
+		c.buf = join(c.buf, d.data, src)
+		c.index(c.buf, 0, n)
+		return c.compress(c.buf, n, dst)
+	case c.dict != d:
+		c.reset()
+		c.load(t)
+		c.dict = d
+		c.buf = join(c.buf, d.data, src)
+		return c.compress(c.buf, n, dst)
+	case len(c.buf)-n < 1<<c.hashLog>>restoreLog:
+		// Only undo the changes made by the previous block.
+		c.restore(t, c.buf, n)
+	default:
+		c.load(t)
+	}
+	// The dictionary is still at the start of buf.
+	c.buf = append(c.buf[:n], src...)
+	return c.compress(c.buf, n, dst)
+}
+
+// restoreLog sets the size of the blocks, relative to the hash table, below which
+// restoring the table entries they changed is cheaper than copying the whole table.
+const restoreLog = 4
 
+// load copies the hash table of t, which has the same size.
+func (c *Compressor) load(t *Compressor) {
+	table, inUse := c.tables()
+	tTable, tInUse := t.tables()
+	copy(table, tTable)
+	copy(inUse, tInUse)
+}
+
+// restore sets the table entries of the positions of src[start:] back to their values in t.
+func (c *Compressor) restore(t *Compressor, src []byte, start int) {
+	table, inUse := c.tables()
+	tTable, tInUse := t.tables()
+	for si := start; si+8 <= len(src); si++ {
+		h := blockHash(binary.LittleEndian.Uint64(src[si:]), c.hashLog)
+		table[h] = tTable[h]
+		inUse[h/32] = inUse[h/32]&^(1<<(h%32)) | tInUse[h/32]&(1<<(h%32))
+	}
+}
+
+// compress compresses src[start:] into dst.
+// Matches may reference src[:start], which must already be indexed in the hash table.
+func (c *Compressor) compress(src []byte, start int, dst []byte) (int, error) {
 	// Return 0, nil only if the destination buffer size is < CompressBlockBound.
-	isNotCompressible := len(dst) < CompressBlockBound(len(src))
+	isNotCompressible := len(dst) < CompressBlockBound(len(src)-start)
 
 	// adaptSkipLog sets how quickly the compressor begins skipping blocks when data is incompressible.
 	// This significantly speeds up incompressible data and usually has very small impact on compression.
 	// bytes to skip =  1 + (bytes since last match >> adaptSkipLog)
 	const adaptSkipLog = 7
 
+	// accel is the number of extra bytes skipped when no match is found.
+	accel := c.Acceleration
+	if accel < 1 {
+		accel = 1
+	} else if accel > maxAcceleration {
+		accel = maxAcceleration
+	}
+	maxOffset := maxOffsetOf(c.MaxOffset)
+
 	// si: Current position of the search.
 	// anchor: Position of the current literals.
-	var si, di, anchor int
+	var di int
+	si, anchor := start, start
 	sn := len(src) - mfLimit
-	if sn <= 0 {
+	if sn <= si {
 		goto lastLiterals
 	}
 
@@ -126,8 +492,8 @@ func (c *Compressor) CompressBlock(src, dst []byte) (int, error) {
 	for si < sn {
 		// Hash the next 6 bytes (sequence)...
 		match := binary.LittleEndian.Uint64(src[si:])
-		h := blockHash(match)
-		h2 := blockHash(match >> 8)
+		h := blockHash(match, c.hashLog)
+		h2 := blockHash(match>>8, c.hashLog)
 
 		// We check a match at s, s+1 and s+2 and pick the first one we get.
 		// Checking 3 only requires us to load the source one.
@@ -138,25 +504,25 @@ func (c *Compressor) CompressBlock(src, dst []byte) (int, error) {
 
 		offset := si - ref
 
-		if offset <= 0 || offset >= winSize || uint32(match) != binary.LittleEndian.Uint32(src[ref:]) {
+		if offset <= 0 || offset > maxOffset || uint32(match) != binary.LittleEndian.Uint32(src[ref:]) {
 			// No match. Start calculating another hash.
 			// The processor can usually do this out-of-order.
-			h = blockHash(match >> 16)
+			h = blockHash(match>>16, c.hashLog)
 			ref3 := c.get(h, si+2)
 
 			// Check the second match at si+1
 			si += 1
 			offset = si - ref2
 
-			if offset <= 0 || offset >= winSize || uint32(match>>8) != binary.LittleEndian.Uint32(src[ref2:]) {
+			if offset <= 0 || offset > maxOffset || uint32(match>>8) != binary.LittleEndian.Uint32(src[ref2:]) {
 				// No match. Check the third match at si+2
 				si += 1
 				offset = si - ref3
 				c.put(h, si)
 
-				if offset <= 0 || offset >= winSize || uint32(match>>16) != binary.LittleEndian.Uint32(src[ref3:]) {
-					// Skip one extra byte (at si+3) before we check 3 matches again.
-					si += 2 + (si-anchor)>>adaptSkipLog
+				if offset <= 0 || offset > maxOffset || uint32(match>>16) != binary.LittleEndian.Uint32(src[ref3:]) {
+					// Skip accel extra bytes (from si+3) before we check 3 matches again.
+					si += 1 + accel + (si-anchor)>>adaptSkipLog
 					continue
 				}
 			}
@@ -251,12 +617,12 @@ func (c *Compressor) CompressBlock(src, dst []byte) (int, error) {
 			break
 		}
 		// Hash match end-2
-		h = blockHash(binary.LittleEndian.Uint64(src[si-2:]))
+		h = blockHash(binary.LittleEndian.Uint64(src[si-2:]), c.hashLog)
 		c.put(h, si-2)
 	}
 
 lastLiterals:
-	if isNotCompressible && anchor == 0 {
+	if isNotCompressible && anchor == start {
 		// Incompressible.
 		return 0, nil
 	}
@@ -283,7 +649,7 @@ lastLiterals:
 	di++
 
 	// Write the last literals.
-	if isNotCompressible && di >= anchor {
+	if isNotCompressible && di >= anchor-start {
 		// Incompressible.
 		return 0, nil
 	}
@@ -294,6 +660,156 @@ lastLiterals:
 	return di, nil
 }
 
+// destSizeReserve is the room kept at the end of the destination by CompressBlockDestSize
+// for the last literals: a token and enough literals for the last match to start
+// at least 12 bytes before the end of the block.
+const destSizeReserve = 1 + 8
+
+// CompressBlockDestSize compresses the longest prefix of src that fits into dst.
+// It returns the number of bytes read from src and written to dst.
+func (c *Compressor) CompressBlockDestSize(src, dst []byte) (int, int) {
+	c.reset()
+	if len(dst) >= CompressBlockBound(len(src)) {
+		// Everything fits.
+		n, _ := c.compress(src, 0, dst)
+		return len(src), n
+	}
+
+	const adaptSkipLog = 7
+	accel := c.Acceleration
+	if accel < 1 {
+		accel = 1
+	} else if accel > maxAcceleration {
+		accel = maxAcceleration
+	}
+	maxOffset := maxOffsetOf(c.MaxOffset)
+
+	var si, di, anchor int
+	sn := len(src) - mfLimit
+	for si < sn {
+		match := binary.LittleEndian.Uint64(src[si:])
+		h := blockHash(match, c.hashLog)
+		ref := c.get(h, si)
+		c.put(h, si)
+
+		offset := si - ref
+		if offset <= 0 || offset > maxOffset || uint32(match) != binary.LittleEndian.Uint32(src[ref:]) {
+			si += accel + (si-anchor)>>adaptSkipLog
+			continue
+		}
+
+		// Extend backwards if we can, reducing literals.
+		for si > anchor && ref > 0 && src[si-1] == src[ref-1] {
+			si--
+			ref--
+		}
+		// Find the longest match by looking by batches of 8 bytes.
+		end := si + minMatch
+		for end+8 <= sn {
+			x := binary.LittleEndian.Uint64(src[end:]) ^ binary.LittleEndian.Uint64(src[end-offset:])
+			if x == 0 {
+				end += 8
+			} else {
+				end += bits.TrailingZeros64(x) >> 3
+				break
+			}
+		}
+
+		// Make sure the sequence fits, shortening the match if required.
+		lLen, mLen := si-anchor, end-si-minMatch
+		room := len(dst) - di - destSizeReserve - (1 + lenSize(lLen) + lLen + 2)
+		if room < 0 {
+			break
+		}
+		if max := 255*room + 14; mLen > max {
+			mLen = max
+		}
+
+		di += encodeLen(dst[di:], lLen, mLen)
+		di += copy(dst[di:], src[anchor:si])
+		dst[di], dst[di+1] = byte(offset), byte(offset>>8)
+		di += 2
+		if mLen >= 0xF {
+			di += encodeExtLen(dst[di:], mLen-0xF)
+		}
+		si += minMatch + mLen
+		anchor = si
+
+		// Check if we can load next values.
+		if si >= sn {
+			break
+		}
+		// Hash match end-2
+		h = blockHash(binary.LittleEndian.Uint64(src[si-2:]), c.hashLog)
+		c.put(h, si-2)
+	}
+
+	// Last literals, as many as fit.
+	lLen := len(src) - anchor
+	if room := len(dst) - di; 1+lenSize(lLen)+lLen > room {
+		if room <= 0 {
+			return anchor, di
+		}
+		lLen = room - 1
+		lLen -= lenSize(lLen)
+	}
+	di += encodeLiterals(dst[di:], src[anchor:anchor+lLen])
+	return anchor + lLen, di
+}
+
+// lenSize returns the number of extra bytes used to encode the literals or match length n.
+func lenSize(n int) int {
+	if n < 0xF {
+		return 0
+	}
+	return 1 + (n-0xF)/0xFF
+}
+
+// encodeLen writes the token for the given literals and match lengths into dst,
+// followed by the extra bytes of the literals length.
+// It returns the number of bytes written.
+func encodeLen(dst []byte, lLen, mLen int) int {
+	var token byte
+	if mLen < 0xF {
+		token = byte(mLen)
+	} else {
+		token = 0xF
+	}
+	if lLen < 0xF {
+		dst[0] = token | byte(lLen<<4)
+		return 1
+	}
+	dst[0] = token | 0xF0
+	return 1 + encodeExtLen(dst[1:], lLen-0xF)
+}
+
+// encodeExtLen writes the extra bytes of a length whose token part has been removed.
+func encodeExtLen(dst []byte, n int) int {
+	i := 0
+	for ; n >= 0xFF; n -= 0xFF {
+		dst[i] = 0xFF
+		i++
+	}
+	dst[i] = byte(n)
+	return i + 1
+}
+
+// encodeLiterals writes src into dst as a last literals sequence.
+func encodeLiterals(dst, src []byte) int {
+	di := encodeLen(dst, len(src), 0)
+	return di + copy(dst[di:], src)
+}
+
+// favorDecSpeedLen shortens the match lengths in (18, 36] to 18, the longest one
+// handled by the fast path of the decoders. The rest of the match is then
+// usually found again as a match of at least minMatch bytes.
+func favorDecSpeedLen(mLen int) int {
+	if mLen > 18 && mLen <= 36 {
+		return 18
+	}
+	return mLen
+}
+
 // blockHash hashes 4 bytes into a value < winSize.
 func blockHashHC(x uint32) uint32 {
 	const hasher uint32 = 2654435761 // Knuth multiplicative hash.
@@ -305,6 +821,22 @@ type CompressorHC struct {
 	// chainTable: stores previous positions for a given hash
 	hashTable, chainTable [htSize]int
 	needsReset            bool
+
+	// MaxOffset is the largest match offset, as for Compressor.
+	MaxOffset int
+	// FavorDecSpeed trades some compression ratio for faster decompression,
+	// by avoiding matches that do not fit the decoders' fast path
+	// and matches saving too few bytes to be worth decoding.
+	// It is only used by the optimal parsing levels.
+	FavorDecSpeed bool
+
+	// Scratch buffer holding a dictionary followed by the data to compress.
+	buf []byte
+	// Prices used by the optimal parser.
+	opt []optimal
+	// Prepared dictionary whose tables were loaded last, if any.
+	// They only differ from its tables at the positions of the data in buf.
+	dict *Dict
 }
 
 var compressorHCPool = sync.Pool{New: func() interface{} { return new(CompressorHC) }}
@@ -316,27 +848,98 @@ func CompressBlockHC(src, dst []byte, depth CompressionLevel) (int, error) {
 	return n, err
 }
 
-func (c *CompressorHC) CompressBlock(src, dst []byte, depth CompressionLevel) (_ int, err error) {
+func (c *CompressorHC) reset() {
 	if c.needsReset {
 		// Zero out reused table to avoid non-deterministic output (issue #65).
 		c.hashTable = [htSize]int{}
 		c.chainTable = [htSize]int{}
 	}
 	c.needsReset = true // Only false on first call.
+	c.dict = nil
+}
+
+// index adds the positions of src[start:end] to the hash and chain tables.
+func (c *CompressorHC) index(src []byte, start, end int) {
+	for si := start; si+4 <= end; si++ {
+		h := blockHashHC(binary.LittleEndian.Uint32(src[si:]))
+		c.chainTable[si&winMask] = c.hashTable[h]
+		c.hashTable[h] = si
+	}
+}
+
+func (c *CompressorHC) CompressBlock(src, dst []byte, depth CompressionLevel) (int, error) {
+	c.reset()
+	return c.compress(src, 0, dst, depth)
+}
+
+// CompressBlockWithDict is like CompressBlock but matches may also reference dict.
+func (c *CompressorHC) CompressBlockWithDict(src, dst, dict []byte, depth CompressionLevel) (int, error) {
+	c.reset()
+	if len(dict) == 0 {
+		return c.compress(src, 0, dst, depth)
+	}
+	dict = trimDict(dict)
+	c.buf = join(c.buf, dict, src)
+	c.index(c.buf, 0, len(dict))
+	return c.compress(c.buf, len(dict), dst, depth)
+}
+
+// CompressBlockWithPreparedDict is like CompressBlockWithDict but uses
+// the hash and chain tables precomputed in d.
+func (c *CompressorHC) CompressBlockWithPreparedDict(src, dst []byte, d *Dict, depth CompressionLevel) (int, error) {
+	if len(d.data) == 0 {
+		return c.CompressBlock(src, dst, depth)
+	}
+	t := d.hcTables()
+	n := len(d.data)
+	c.needsReset = true
+	if c.dict != d || len(c.buf)-n >= winSize {
+		c.hashTable, c.chainTable = t.hashTable, t.chainTable
+		c.dict = d
+		c.buf = join(c.buf, d.data, src)
+		return c.compress(c.buf, n, dst, depth)
+	}
+	// Only undo the changes made by the previous block,
+	// whose dictionary is still at the start of buf.
+	c.restore(t, c.buf, n)
+	c.buf = append(c.buf[:n], src...)
+	return c.compress(c.buf, n, dst, depth)
+}
 
+// restore sets the table entries of the positions of src[start:] back to their values in t.
+func (c *CompressorHC) restore(t *CompressorHC, src []byte, start int) {
+	for si := start; si+4 <= len(src); si++ {
+		h := blockHashHC(binary.LittleEndian.Uint32(src[si:]))
+		c.hashTable[h] = t.hashTable[h]
+		c.chainTable[si&winMask] = t.chainTable[si&winMask]
+	}
+}
+
+// compress compresses src[start:] into dst.
+// Matches may reference src[:start], which must already be indexed in the hash and chain tables.
+func (c *CompressorHC) compress(src []byte, start int, dst []byte, depth CompressionLevel) (_ int, err error) {
 	defer recoverBlock(&err)
 
+	switch {
+	case depth == Store:
+		return storeBlock(src[start:], dst)
+	case depth >= Level10:
+		return c.compressOpt(src, start, dst, depth)
+	}
+
 	// Return 0, nil only if the destination buffer size is < CompressBlockBound.
-	isNotCompressible := len(dst) < CompressBlockBound(len(src))
+	isNotCompressible := len(dst) < CompressBlockBound(len(src)-start)
 
 	// adaptSkipLog sets how quickly the compressor begins skipping blocks when data is incompressible.
 	// This significantly speeds up incompressible data and usually has very small impact on compression.
 	// bytes to skip =  1 + (bytes since last match >> adaptSkipLog)
 	const adaptSkipLog = 7
 
-	var si, di, anchor int
+	maxOffset := maxOffsetOf(c.MaxOffset)
+	var di int
+	si, anchor := start, start
 	sn := len(src) - mfLimit
-	if sn <= 0 {
+	if sn <= si {
 		goto lastLiterals
 	}
 
@@ -352,7 +955,7 @@ func (c *CompressorHC) CompressBlock(src, dst []byte, depth CompressionLevel) (_
 		// Follow the chain until out of window and give the longest match.
 		mLen := 0
 		offset := 0
-		for next, try := c.hashTable[h], depth; try > 0 && next > 0 && si-next < winSize; next, try = c.chainTable[next&winMask], try-1 {
+		for next, try := c.hashTable[h], depth; try > 0 && next > 0 && si-next <= maxOffset; next, try = c.chainTable[next&winMask], try-1 {
 			// The first (mLen==0) or next byte (mLen>=minMatch) at current match length
 			// must match to improve on the match length.
 			if src[next+mLen] != src[si+mLen] {
@@ -449,7 +1052,7 @@ func (c *CompressorHC) CompressBlock(src, dst []byte, depth CompressionLevel) (_
 		}
 	}
 
-	if isNotCompressible && anchor == 0 {
+	if isNotCompressible && anchor == start {
 		// Incompressible.
 		return 0, nil
 	}
@@ -472,7 +1075,7 @@ lastLiterals:
 	di++
 
 	// Write the last literals.
-	if isNotCompressible && di >= anchor {
+	if isNotCompressible && di >= anchor-start {
 		// Incompressible.
 		return 0, nil
 	}
@@ -4,8 +4,11 @@ package lz4block_test
 
 import (
 	"bytes"
+	"errors"
 	"fmt"
 	"io/ioutil"
+	"math/rand"
+	"strings"
 	"testing"
 
 	"github.com/pierrec/lz4/v4"
@@ -94,7 +97,7 @@ func TestCompressUncompressBlock(t *testing.T) {
 		}
 		tc.src = src
 
-		var n, nhc int
+		var n, nhc, nopt int
 		t.Run("", func(t *testing.T) {
 			tc := tc
 			t.Run(tc.file, func(t *testing.T) {
@@ -107,9 +110,14 @@ func TestCompressUncompressBlock(t *testing.T) {
 					return lz4.CompressBlockHC(src, dst, 10, nil, nil)
 				})
 			})
+			t.Run(fmt.Sprintf("%s OPT", tc.file), func(t *testing.T) {
+				nopt = run(t, tc, func(src, dst []byte) (int, error) {
+					return lz4block.CompressBlockHC(src, dst, lz4block.Level11)
+				})
+			})
 		})
 		if !t.Failed() {
-			t.Logf("%-40s: %8d / %8d / %8d\n", tc.file, n, nhc, len(src))
+			t.Logf("%-40s: %8d / %8d / %8d / %8d\n", tc.file, n, nhc, nopt, len(src))
 		}
 	}
 }
@@ -200,3 +208,1159 @@ func TestWriteLiteralLen(t *testing.T) {
 		lz4block.CompressBlock([]byte(c.src), dst)
 	}
 }
+
+func TestCompressBlockWithDict(t *testing.T) {
+	src, err := ioutil.ReadFile("../../testdata/pg1661.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Use the start of the file as dictionary for small chunks further along.
+	dict := src[:64<<10]
+	prepared := lz4block.NewDict(dict)
+
+	type compressor func(src, dst []byte) (int, error)
+	var c lz4block.Compressor
+	var chc lz4block.CompressorHC
+	for _, tc := range []struct {
+		name                 string
+		plain, raw, prepared compressor
+	}{
+		{
+			"fast",
+			func(src, dst []byte) (int, error) { return c.CompressBlock(src, dst) },
+			func(src, dst []byte) (int, error) { return c.CompressBlockWithDict(src, dst, dict) },
+			func(src, dst []byte) (int, error) { return c.CompressBlockWithPreparedDict(src, dst, prepared) },
+		},
+		{
+			"HC",
+			func(src, dst []byte) (int, error) { return chc.CompressBlock(src, dst, 0) },
+			func(src, dst []byte) (int, error) { return chc.CompressBlockWithDict(src, dst, dict, 0) },
+			func(src, dst []byte) (int, error) { return chc.CompressBlockWithPreparedDict(src, dst, prepared, 0) },
+		},
+		{
+			"HC optimal",
+			func(src, dst []byte) (int, error) { return chc.CompressBlock(src, dst, lz4block.Level10) },
+			func(src, dst []byte) (int, error) { return chc.CompressBlockWithDict(src, dst, dict, lz4block.Level10) },
+			func(src, dst []byte) (int, error) {
+				return chc.CompressBlockWithPreparedDict(src, dst, prepared, lz4block.Level10)
+			},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			var plainSize, dictSize int
+			for _, size := range []int{16, 100, 1000, 4000} {
+				for off := len(dict); off+size <= len(src); off += 50000 {
+					block := src[off : off+size]
+
+					zplain := make([]byte, lz4block.CompressBlockBound(size))
+					n, err := tc.plain(block, zplain)
+					if err != nil {
+						t.Fatal(err)
+					}
+					plainSize += n
+
+					zraw := make([]byte, lz4block.CompressBlockBound(size))
+					n, err = tc.raw(block, zraw)
+					if err != nil {
+						t.Fatal(err)
+					}
+					zraw = zraw[:n]
+					dictSize += n
+
+					zprepared := make([]byte, lz4block.CompressBlockBound(size))
+					n, err = tc.prepared(block, zprepared)
+					if err != nil {
+						t.Fatal(err)
+					}
+					if !bytes.Equal(zraw, zprepared[:n]) {
+						t.Fatalf("size %d offset %d: prepared dictionary output differs", size, off)
+					}
+					// Again, with the tables left over by the previous block.
+					n, err = tc.prepared(block, zprepared)
+					if err != nil {
+						t.Fatal(err)
+					}
+					if !bytes.Equal(zraw, zprepared[:n]) {
+						t.Fatalf("size %d offset %d: reused prepared dictionary output differs", size, off)
+					}
+
+					out := make([]byte, size)
+					n, err = lz4block.UncompressBlock(zraw, out, dict)
+					if err != nil {
+						t.Fatal(err)
+					}
+					if !bytes.Equal(out[:n], block) {
+						t.Fatalf("size %d offset %d: uncompressed data does not match original", size, off)
+					}
+				}
+			}
+			if dictSize >= plainSize {
+				t.Errorf("dictionary did not improve compression: %d >= %d", dictSize, plainSize)
+			}
+		})
+	}
+}
+
+func TestStreamCompressor(t *testing.T) {
+	src, err := ioutil.ReadFile("../../testdata/pg1661.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	type compressor func(src, dst []byte) (int, error)
+	for _, size := range []int{100, 1000, 100000} {
+		var c lz4block.StreamCompressor
+		var chc lz4block.StreamCompressorHC
+		for _, tc := range []struct {
+			name     string
+			compress compressor
+		}{
+			{"fast", func(src, dst []byte) (int, error) { return c.CompressBlock(src, dst) }},
+			{"HC", func(src, dst []byte) (int, error) { return chc.CompressBlock(src, dst, 0) }},
+		} {
+			t.Run(fmt.Sprintf("%s/%d", tc.name, size), func(t *testing.T) {
+				var zsize, zindep int
+				var out []byte
+				for off := 0; off < len(src); off += size {
+					end := off + size
+					if end > len(src) {
+						end = len(src)
+					}
+					block := src[off:end]
+
+					zbuf := make([]byte, lz4block.CompressBlockBound(len(block)))
+					n, err := tc.compress(block, zbuf)
+					if err != nil {
+						t.Fatal(err)
+					}
+					zsize += n
+					m, _ := lz4block.CompressBlock(block, make([]byte, len(zbuf)))
+					zindep += m
+
+					dict := out
+					if len(dict) > 64<<10 {
+						dict = dict[len(dict)-64<<10:]
+					}
+					buf := make([]byte, len(block))
+					if n == 0 {
+						// Incompressible block, stored as is.
+						copy(buf, block)
+					} else if _, err := lz4block.UncompressBlock(zbuf[:n], buf, dict); err != nil {
+						t.Fatalf("offset %d: %v", off, err)
+					}
+					if !bytes.Equal(buf, block) {
+						t.Fatalf("offset %d: uncompressed data does not match original", off)
+					}
+					out = append(out, buf...)
+				}
+				if zsize >= zindep {
+					t.Errorf("dependent blocks not smaller than independent ones: %d >= %d", zsize, zindep)
+				}
+			})
+		}
+	}
+}
+
+func TestStreamDecompressor(t *testing.T) {
+	src, err := ioutil.ReadFile("../../testdata/pg1661.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, size := range []int{100, 5000, 70000} {
+		for _, contiguous := range []bool{false, true} {
+			t.Run(fmt.Sprintf("%d contiguous=%v", size, contiguous), func(t *testing.T) {
+				var c lz4block.StreamCompressor
+				var d lz4block.StreamDecompressor
+				out := make([]byte, len(src))
+				for off := 0; off < len(src); off += size {
+					end := off + size
+					if end > len(src) {
+						end = len(src)
+					}
+					block := src[off:end]
+
+					zbuf := make([]byte, lz4block.CompressBlockBound(len(block)))
+					n, err := c.CompressBlock(block, zbuf)
+					if err != nil {
+						t.Fatal(err)
+					}
+					buf := make([]byte, len(block))
+					if contiguous {
+						buf = out[off:end]
+					}
+					if n == 0 {
+						copy(buf, block)
+						d.AddUncompressed(buf)
+					} else if _, err := d.UncompressBlock(zbuf[:n], buf); err != nil {
+						t.Fatalf("offset %d: %v", off, err)
+					}
+					if !bytes.Equal(buf, block) {
+						t.Fatalf("offset %d: uncompressed data does not match original", off)
+					}
+
+					// The history references the output instead of copying it.
+					dict := d.Dict()
+					if contiguous && &dict[len(dict)-1] != &out[end-1] {
+						t.Fatalf("offset %d: history copied", off)
+					}
+				}
+			})
+		}
+	}
+}
+
+func TestCompressBlockAcceleration(t *testing.T) {
+	src, err := ioutil.ReadFile("../../testdata/pg1661.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	zbuf := make([]byte, lz4block.CompressBlockBound(len(src)))
+	buf := make([]byte, len(src))
+	prev := 0
+	for _, accel := range []int{0, 1, 4, 16, 1 << 20} {
+		c := lz4block.Compressor{Acceleration: accel}
+		n, err := c.CompressBlock(src, zbuf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if n < prev {
+			t.Errorf("acceleration %d: compressed size %d smaller than with a lower acceleration (%d)", accel, n, prev)
+		}
+		prev = n
+
+		m, err := lz4block.UncompressBlock(zbuf[:n], buf, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(buf[:m], src) {
+			t.Fatalf("acceleration %d: uncompressed data does not match original", accel)
+		}
+	}
+}
+
+func TestCompressBlockDestSize(t *testing.T) {
+	for _, file := range []string{
+		"../../testdata/pg1661.txt",
+		"../../testdata/random.data",
+		"../../testdata/repeat.txt",
+	} {
+		src, err := ioutil.ReadFile(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Run(file, func(t *testing.T) {
+			var c lz4block.Compressor
+			for _, size := range []int{0, 1, 2, 10, 16, 17, 100, 300, 4096, 10000, 70000, lz4block.CompressBlockBound(len(src))} {
+				dst := make([]byte, size)
+				read, n := c.CompressBlockDestSize(src, dst)
+				if n > size {
+					t.Fatalf("dst size %d: %d bytes written", size, n)
+				}
+				if read > len(src) {
+					t.Fatalf("dst size %d: %d bytes read out of %d", size, read, len(src))
+				}
+				if read < len(src) && n < size-destSizeSlack {
+					t.Errorf("dst size %d: only %d bytes written", size, n)
+				}
+				if n == 0 {
+					continue
+				}
+
+				buf := make([]byte, read)
+				m, err := lz4block.UncompressBlock(dst[:n], buf, nil)
+				if err != nil {
+					t.Fatalf("dst size %d: %v", size, err)
+				}
+				if !bytes.Equal(buf[:m], src[:read]) {
+					t.Fatalf("dst size %d: uncompressed data does not match original", size)
+				}
+			}
+		})
+	}
+}
+
+// destSizeSlack is the maximum number of unused bytes at the end of the destination
+// when CompressBlockDestSize cannot compress all of its input.
+const destSizeSlack = 10
+
+func TestUncompressBlockPartial(t *testing.T) {
+	src, err := ioutil.ReadFile("../../testdata/pg1661.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	dict := src[:64<<10]
+	block := src[64<<10 : 128<<10]
+
+	zbuf := make([]byte, lz4block.CompressBlockBound(len(block)))
+	n, err := lz4block.CompressBlock(block, zbuf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	zplain := zbuf[:n]
+
+	var c lz4block.Compressor
+	zbuf = make([]byte, lz4block.CompressBlockBound(len(block)))
+	n, err = c.CompressBlockWithDict(block, zbuf, dict)
+	if err != nil {
+		t.Fatal(err)
+	}
+	zdict := zbuf[:n]
+
+	for _, tc := range []struct {
+		name string
+		zsrc []byte
+		dict []byte
+	}{
+		{"plain", zplain, nil},
+		{"dict", zdict, dict},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			for _, target := range []int{1, 7, 100, 1000, 12345, len(block) - 1, len(block), len(block) + 1} {
+				dst := make([]byte, len(block)+1)
+				n, err := lz4block.UncompressBlockPartial(tc.zsrc, dst, tc.dict, target)
+				if err != nil {
+					t.Fatalf("target %d: %v", target, err)
+				}
+				want := target
+				if want > len(block) {
+					want = len(block)
+				}
+				if n != want {
+					t.Fatalf("target %d: got %d bytes; want %d", target, n, want)
+				}
+				if !bytes.Equal(dst[:n], block[:n]) {
+					t.Fatalf("target %d: uncompressed data does not match original", target)
+				}
+			}
+		})
+	}
+
+	// The target is capped to the destination size.
+	dst := make([]byte, 10)
+	if n, err := lz4block.UncompressBlockPartial(zplain, dst, nil, 100); err != nil || n != len(dst) {
+		t.Fatalf("got %d, %v; want %d, nil", n, err, len(dst))
+	}
+
+	// Only the part of the block being read is validated.
+	corrupt := append([]byte(nil), zplain...)
+	corrupt[len(corrupt)-1]++
+	if _, err := lz4block.UncompressBlockPartial(corrupt[:len(corrupt)/2], make([]byte, 1000), nil, 1000); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := lz4block.UncompressBlockPartial([]byte("\x35foo\xff\xff"), make([]byte, 100), nil, 100); !errors.Is(err, lz4errors.ErrOffsetOutOfRange) {
+		t.Fatalf("got %v; want %v", err, lz4errors.ErrOffsetOutOfRange)
+	}
+}
+
+func TestUncompressInPlace(t *testing.T) {
+	// inPlace uncompresses zbuf in place, with the smallest buffer allowed.
+	inPlace := func(zbuf, want []byte) {
+		t.Helper()
+		buf := make([]byte, len(want)+lz4block.InPlaceMargin(len(zbuf)))
+		offset := len(buf) - len(zbuf)
+		copy(buf[offset:], zbuf)
+		n, err := lz4block.UncompressInPlace(buf, offset)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(buf[:n], want) {
+			t.Fatal("uncompressed data does not match original")
+		}
+
+		// One byte short.
+		buf = buf[1:]
+		copy(buf[offset-1:], zbuf)
+		if _, err := lz4block.UncompressInPlace(buf, offset-1); err != lz4errors.ErrInvalidSourceShortBuffer {
+			t.Fatalf("got %v; want %v", err, lz4errors.ErrInvalidSourceShortBuffer)
+		}
+	}
+
+	for _, tc := range rawFiles {
+		src, err := ioutil.ReadFile(tc.file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Run(tc.file, func(t *testing.T) {
+			for _, level := range []lz4block.CompressionLevel{lz4block.Fast, lz4block.Level10} {
+				zbuf := make([]byte, lz4block.CompressBlockBound(len(src)))
+				n, err := lz4block.Params{Level: level}.CompressBlock(src, zbuf)
+				if err != nil {
+					t.Fatal(err)
+				}
+				inPlace(zbuf[:n], src)
+			}
+		})
+	}
+
+	// Blocks made of the sequences the least favourable to in place decompression:
+	// literals barely requiring an extra length byte followed by short matches,
+	// short literals that fit the decoders' fast paths, long literal runs
+	// and long matches expanding the last bytes.
+	rnd := rand.New(rand.NewSource(1))
+	for i := 0; i < 1000; i++ {
+		var zbuf, want []byte
+		for n := rnd.Intn(200); n >= 0; n-- {
+			lLen := 15
+			switch rnd.Intn(4) {
+			case 0:
+				lLen = rnd.Intn(15)
+			case 1:
+				lLen = 15 + rnd.Intn(300)
+			}
+			if len(want)+lLen == 0 {
+				lLen = 1
+			}
+			mLen, offset := 4+rnd.Intn(16), 1+rnd.Intn(len(want)+lLen)
+			if rnd.Intn(8) == 0 {
+				// Long repetition of the last bytes.
+				mLen, offset = 4+rnd.Intn(2000), 1
+			}
+			zbuf, want = appendSequence(zbuf, want, rnd, lLen, mLen, offset)
+		}
+		zbuf, want = appendSequence(zbuf, want, rnd, rnd.Intn(2000), 0, 0)
+		inPlace(zbuf, want)
+	}
+}
+
+// appendSequence appends a sequence of lLen random literals and a match to zbuf,
+// and its uncompressed data to data.
+// The match is omitted if mLen is 0.
+func appendSequence(zbuf, data []byte, rnd *rand.Rand, lLen, mLen, offset int) ([]byte, []byte) {
+	var token byte
+	if lLen < 0xF {
+		token = byte(lLen) << 4
+	} else {
+		token = 0xF0
+	}
+	if mLen >= 4+0xF {
+		token |= 0xF
+	} else if mLen > 0 {
+		token |= byte(mLen - 4)
+	}
+	zbuf = append(zbuf, token)
+	zbuf = appendExtLen(zbuf, lLen)
+	for i := 0; i < lLen; i++ {
+		c := byte(rnd.Intn(256))
+		zbuf = append(zbuf, c)
+		data = append(data, c)
+	}
+	if mLen == 0 {
+		return zbuf, data
+	}
+	zbuf = append(zbuf, byte(offset), byte(offset>>8))
+	zbuf = appendExtLen(zbuf, mLen-4)
+	for i := 0; i < mLen; i++ {
+		data = append(data, data[len(data)-offset])
+	}
+	return zbuf, data
+}
+
+// appendExtLen appends the extra bytes of the length n.
+func appendExtLen(zbuf []byte, n int) []byte {
+	if n < 0xF {
+		return zbuf
+	}
+	for n -= 0xF; n >= 0xFF; n -= 0xFF {
+		zbuf = append(zbuf, 0xFF)
+	}
+	return append(zbuf, byte(n))
+}
+
+func TestUncompressBlockSized(t *testing.T) {
+	src, err := ioutil.ReadFile("../../testdata/pg1661.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Blocks of various sizes stored back to back, with their uncompressed sizes.
+	var (
+		zbuf  []byte
+		sizes []int
+	)
+	for i, size := 0, 0; i+size <= len(src); i, size = i+size, (size*7+100)%(64<<10) {
+		block := src[i : i+size]
+		level := lz4block.Fast
+		if len(sizes)%2 == 1 {
+			level = lz4block.Level10
+		}
+		buf := make([]byte, lz4block.CompressBlockBound(len(block)))
+		n, err := lz4block.Params{Level: level}.CompressBlock(block, buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		zbuf = append(zbuf, buf[:n]...)
+		sizes = append(sizes, size)
+	}
+
+	var si, di int
+	for i, size := range sizes {
+		dst := make([]byte, size)
+		written, consumed, err := lz4block.UncompressBlockSized(zbuf[si:], dst, nil)
+		if err != nil {
+			t.Fatalf("block %d: %v", i, err)
+		}
+		if written != size {
+			t.Fatalf("block %d: got %d bytes; want %d", i, written, size)
+		}
+		if !bytes.Equal(dst, src[di:di+size]) {
+			t.Fatalf("block %d: uncompressed data does not match original", i)
+		}
+
+		// Wrong sizes.
+		if size > 0 {
+			if _, _, err := lz4block.UncompressBlockSized(zbuf[si:], dst[:size-1], nil); !errors.Is(err, lz4errors.ErrInvalidSourceShortBuffer) {
+				t.Fatalf("block %d: got %v; want %v", i, err, lz4errors.ErrInvalidSourceShortBuffer)
+			}
+		}
+		if _, _, err := lz4block.UncompressBlockSized(zbuf[si:si+consumed], make([]byte, size+1), nil); !errors.Is(err, lz4errors.ErrCorruptBlock) {
+			t.Fatalf("block %d: got %v; want %v", i, err, lz4errors.ErrCorruptBlock)
+		}
+
+		si += consumed
+		di += size
+	}
+	if si != len(zbuf) {
+		t.Fatalf("consumed %d bytes; want %d", si, len(zbuf))
+	}
+
+	// With a dictionary.
+	dict := src[:64<<10]
+	block := src[64<<10 : 80<<10]
+	var c lz4block.Compressor
+	buf := make([]byte, lz4block.CompressBlockBound(len(block)))
+	n, err := c.CompressBlockWithDict(block, buf, dict)
+	if err != nil {
+		t.Fatal(err)
+	}
+	buf = append(buf[:n], "next block"...)
+	dst := make([]byte, len(block))
+	if _, consumed, err := lz4block.UncompressBlockSized(buf, dst, dict); err != nil || consumed != n || !bytes.Equal(dst, block) {
+		t.Fatalf("got %d, %v; want %d, nil", consumed, err, n)
+	}
+}
+
+func TestCompressBlockOpt(t *testing.T) {
+	src, err := ioutil.ReadFile("../../testdata/pg1661.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	compress := func(src []byte, level lz4block.CompressionLevel) []byte {
+		t.Helper()
+		zbuf := make([]byte, lz4block.CompressBlockBound(len(src)))
+		n, err := lz4block.CompressBlockHC(src, zbuf, level)
+		if err != nil {
+			t.Fatal(err)
+		}
+		zbuf = zbuf[:n]
+
+		buf := make([]byte, len(src))
+		n, err = lz4block.UncompressBlock(zbuf, buf, nil)
+		if err != nil {
+			t.Fatalf("level %d: %v", level, err)
+		}
+		if !bytes.Equal(buf[:n], src) {
+			t.Fatalf("level %d: uncompressed data does not match original", level)
+		}
+		return zbuf
+	}
+
+	// Small and repetitive inputs.
+	for n := 0; n < 100; n++ {
+		compress(bytes.Repeat([]byte("abc"), n), lz4block.Level12)
+		compress(src[:n], lz4block.Level12)
+	}
+
+	prev := len(compress(src, 1<<17)) // Level9
+	for _, level := range []lz4block.CompressionLevel{lz4block.Level10, lz4block.Level11, lz4block.Level12} {
+		n := len(compress(src, level))
+		if n >= prev {
+			t.Errorf("level %d: compressed size %d not smaller than %d", level, n, prev)
+		}
+		prev = n
+	}
+}
+
+func TestCompressBlockHashLog(t *testing.T) {
+	src, err := ioutil.ReadFile("../../testdata/pg1661.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	dict := src[:64<<10]
+	prepared := lz4block.NewDict(dict)
+	block := src[64<<10:]
+
+	// The same Compressor is reused with different table sizes.
+	var c lz4block.Compressor
+	sizes := make(map[int]int)
+	for _, hashLog := range []int{lz4block.MinHashLog, 12, 0, lz4block.MaxHashLog, 1, 100} {
+		c.HashLog = hashLog
+		zbuf := make([]byte, lz4block.CompressBlockBound(len(src)))
+		n, err := c.CompressBlock(src, zbuf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		sizes[hashLog] = n
+
+		buf := make([]byte, len(src))
+		n, err = lz4block.UncompressBlock(zbuf[:n], buf, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(buf[:n], src) {
+			t.Fatalf("hashLog %d: uncompressed data does not match original", hashLog)
+		}
+
+		zraw := make([]byte, lz4block.CompressBlockBound(len(block)))
+		n, err = c.CompressBlockWithDict(block, zraw, dict)
+		if err != nil {
+			t.Fatal(err)
+		}
+		zraw = zraw[:n]
+		zprepared := make([]byte, lz4block.CompressBlockBound(len(block)))
+		n, err = c.CompressBlockWithPreparedDict(block, zprepared, prepared)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(zraw, zprepared[:n]) {
+			t.Fatalf("hashLog %d: prepared dictionary output differs", hashLog)
+		}
+	}
+	if !(sizes[lz4block.MinHashLog] > sizes[12] && sizes[12] > sizes[0] && sizes[0] > sizes[lz4block.MaxHashLog]) {
+		t.Errorf("compressed sizes do not decrease with the table size: %v", sizes)
+	}
+	if sizes[1] != sizes[lz4block.MinHashLog] || sizes[100] != sizes[lz4block.MaxHashLog] {
+		t.Errorf("table size not capped: %v", sizes)
+	}
+
+	// The table size of a StreamCompressor may change between blocks.
+	var s lz4block.StreamCompressor
+	var d lz4block.StreamDecompressor
+	for i, hashLog := range []int{0, 10, 10, 18} {
+		chunk := src[i*32<<10 : (i+1)*32<<10]
+		s.HashLog = hashLog
+		zbuf := make([]byte, lz4block.CompressBlockBound(len(chunk)))
+		n, err := s.CompressBlock(chunk, zbuf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		buf := make([]byte, len(chunk))
+		n, err = d.UncompressBlock(zbuf[:n], buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(buf[:n], chunk) {
+			t.Fatalf("block %d: uncompressed data does not match original", i)
+		}
+	}
+}
+
+func TestCompressBlockMaxOffset(t *testing.T) {
+	src, err := ioutil.ReadFile("../../testdata/pg1661.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	dict := src[:64<<10]
+	block := src[64<<10 : 256<<10]
+
+	// checkOffsets makes sure that no match of zbuf goes further back than maxOffset.
+	checkOffsets := func(zbuf []byte, maxOffset int) {
+		t.Helper()
+		s := lz4block.NewSequenceScanner(zbuf, len(dict))
+		for s.Scan() {
+			if seq := s.Sequence(); seq.Offset > maxOffset {
+				t.Fatalf("got offset %d; want at most %d", seq.Offset, maxOffset)
+			}
+		}
+		if err := s.Err(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var c lz4block.Compressor
+	var chc lz4block.CompressorHC
+	for _, tc := range []struct {
+		name     string
+		compress func(src, dst, dict []byte, maxOffset int) (int, error)
+	}{
+		{"fast", func(src, dst, dict []byte, maxOffset int) (int, error) {
+			c.MaxOffset = maxOffset
+			return c.CompressBlockWithDict(src, dst, dict)
+		}},
+		{"HC", func(src, dst, dict []byte, maxOffset int) (int, error) {
+			chc.MaxOffset = maxOffset
+			return chc.CompressBlockWithDict(src, dst, dict, 0)
+		}},
+		{"OPT", func(src, dst, dict []byte, maxOffset int) (int, error) {
+			chc.MaxOffset = maxOffset
+			return chc.CompressBlockWithDict(src, dst, dict, lz4block.Level10)
+		}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			prev := 0
+			for _, maxOffset := range []int{0, 16 << 10, 4 << 10, 100} {
+				zbuf := make([]byte, lz4block.CompressBlockBound(len(block)))
+				n, err := tc.compress(block, zbuf, dict, maxOffset)
+				if err != nil {
+					t.Fatal(err)
+				}
+				zbuf = zbuf[:n]
+				if maxOffset > 0 {
+					checkOffsets(zbuf, maxOffset)
+				}
+				if n < prev {
+					t.Errorf("max offset %d: compressed size %d smaller than with a larger window %d", maxOffset, n, prev)
+				}
+				prev = n
+
+				buf := make([]byte, len(block))
+				n, err = lz4block.UncompressBlock(zbuf, buf, dict)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if !bytes.Equal(buf[:n], block) {
+					t.Fatalf("max offset %d: uncompressed data does not match original", maxOffset)
+				}
+			}
+		})
+	}
+
+	// Pooled compressors.
+	for _, level := range []lz4block.CompressionLevel{lz4block.Fast, 1 << 17, lz4block.Level11} { // Fast, Level9, Level11
+		p := lz4block.Params{Level: level, MaxOffset: 1 << 10}
+		zbuf := make([]byte, lz4block.CompressBlockBound(len(block)))
+		n, err := p.CompressBlock(block, zbuf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		checkOffsets(zbuf[:n], p.MaxOffset)
+	}
+}
+
+func TestCompressBlockFavorDecSpeed(t *testing.T) {
+	src, err := ioutil.ReadFile("../../testdata/pg1661.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, level := range []lz4block.CompressionLevel{lz4block.Level10, lz4block.Level12} {
+		// Number of matches that do not fit the decoders' fast path, of sequences
+		// and compressed sizes.
+		var slow, seqs, sizes [2]int
+		for i, favor := range []bool{false, true} {
+			c := lz4block.CompressorHC{FavorDecSpeed: favor}
+			zbuf := make([]byte, lz4block.CompressBlockBound(len(src)))
+			n, err := c.CompressBlock(src, zbuf, level)
+			if err != nil {
+				t.Fatal(err)
+			}
+			zbuf = zbuf[:n]
+			sizes[i] = n
+
+			s := lz4block.NewSequenceScanner(zbuf, 0)
+			for s.Scan() {
+				seq := s.Sequence()
+				seqs[i]++
+				if seq.MatchLen > 18 && seq.MatchLen <= 36 || seq.MatchLen > 0 && seq.Offset < 8 {
+					slow[i]++
+				}
+			}
+			if err := s.Err(); err != nil {
+				t.Fatal(err)
+			}
+
+			buf := make([]byte, len(src))
+			n, err = lz4block.UncompressBlock(zbuf, buf, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(buf[:n], src) {
+				t.Fatalf("level %d: uncompressed data does not match original", level)
+			}
+		}
+		if slow[1] >= slow[0]/2 {
+			t.Errorf("level %d: got %d matches of 19 to 36 bytes or offset below 8; want less than %d", level, slow[1], slow[0]/2)
+		}
+		if seqs[1] >= seqs[0] {
+			t.Errorf("level %d: got %d sequences; want less than %d", level, seqs[1], seqs[0])
+		}
+		if sizes[1] > sizes[0]+sizes[0]/50 {
+			t.Errorf("level %d: compressed size %d more than 2%% larger than %d", level, sizes[1], sizes[0])
+		}
+	}
+}
+
+func TestCompressBlocks(t *testing.T) {
+	src, err := ioutil.ReadFile("../../testdata/pg1661.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Pages of various sizes, some of them empty or incompressible.
+	var pages [][]byte
+	for i, size := 0, 0; i+size <= len(src); i, size = i+size, (size*7+1000)%(64<<10) {
+		pages = append(pages, src[i:i+size])
+	}
+	random := make([]byte, 8<<10)
+	rand.New(rand.NewSource(1)).Read(random)
+	pages = append(pages, random)
+
+	for _, p := range []lz4block.Params{
+		{Level: lz4block.Fast},
+		{Store: true},
+		{Level: 1},       // search depth of 1, not to be confused with Store
+		{Level: 1 << 17}, // Level9
+		{Level: lz4block.Level10},
+	} {
+		for _, workers := range []int{0, 1, 4, 1000} {
+			zpages := make([][]byte, len(pages))
+			for i, page := range pages {
+				zpages[i] = make([]byte, lz4block.CompressBlockBound(len(page)))
+			}
+			if err := p.CompressBlocks(zpages, pages, workers); err != nil {
+				t.Fatal(err)
+			}
+			for i, page := range pages {
+				zbuf := make([]byte, lz4block.CompressBlockBound(len(page)))
+				n, err := p.CompressBlock(page, zbuf)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if !bytes.Equal(zpages[i], zbuf[:n]) {
+					t.Fatalf("%+v, %d workers: block %d differs from CompressBlock", p, workers, i)
+				}
+			}
+
+			out := make([][]byte, len(pages))
+			for i, page := range pages {
+				out[i] = make([]byte, len(page))
+			}
+			if err := lz4block.UncompressBlocks(out, zpages, workers); err != nil {
+				t.Fatal(err)
+			}
+			for i, page := range pages {
+				if !bytes.Equal(out[i], page) {
+					t.Fatalf("%+v, %d workers: block %d: uncompressed data does not match original", p, workers, i)
+				}
+			}
+		}
+	}
+
+	// Only Store encodes the text as literals.
+	for _, p := range []lz4block.Params{{Store: true}, {Level: 1}} {
+		zbuf := make([]byte, lz4block.CompressBlockBound(len(pages[1])))
+		n, err := p.CompressBlock(pages[1], zbuf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if literals := n > len(pages[1]); literals != p.Store {
+			t.Errorf("%+v: got %d bytes for %d bytes of text", p, n, len(pages[1]))
+		}
+	}
+
+	// Incompressible data in a small buffer.
+	zpages := [][]byte{make([]byte, len(random))}
+	if err := (lz4block.Params{}).CompressBlocks(zpages, [][]byte{random}, 2); err != nil || len(zpages[0]) != 0 {
+		t.Fatalf("got %d bytes, %v; want 0 bytes, nil", len(zpages[0]), err)
+	}
+
+	// The error of the first failed block is reported.
+	zpages = [][]byte{{0x10, 'a'}, {0xFF}, {0x10, 'b'}, {0x0F}}
+	out := [][]byte{make([]byte, 1), make([]byte, 100), make([]byte, 1), make([]byte, 100)}
+	err = lz4block.UncompressBlocks(out, zpages, 4)
+	if !errors.Is(err, lz4errors.ErrInvalidSourceShortBuffer) || !strings.HasPrefix(err.Error(), "block 1:") {
+		t.Fatalf("got %v; want an error for block 1", err)
+	}
+	// The numbers of buffers are reported.
+	err = lz4block.UncompressBlocks(out[:1], zpages, 1)
+	if !errors.Is(err, lz4errors.ErrInvalidSourceShortBuffer) || !strings.Contains(err.Error(), "1 destination buffers for 4 blocks") {
+		t.Fatalf("got %v; want a buffer count error", err)
+	}
+	err = (lz4block.Params{}).CompressBlocks(out[:1], zpages, 1)
+	if !errors.Is(err, lz4errors.ErrInvalidSourceShortBuffer) || !strings.Contains(err.Error(), "1 destination buffers for 4 blocks") {
+		t.Fatalf("got %v; want a buffer count error", err)
+	}
+}
+
+func TestCompressBlockHCStore(t *testing.T) {
+	src, err := ioutil.ReadFile("../../testdata/pg1661.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	dict, src := src[:4<<10], src[4<<10:8<<10]
+
+	var c lz4block.CompressorHC
+	for _, tc := range []struct {
+		name     string
+		compress func(dst []byte) (int, error)
+	}{
+		{"CompressBlockHC", func(dst []byte) (int, error) { return lz4block.CompressBlockHC(src, dst, lz4block.Store) }},
+		{"CompressBlock", func(dst []byte) (int, error) { return c.CompressBlock(src, dst, lz4block.Store) }},
+		{"CompressBlockWithDict", func(dst []byte) (int, error) { return c.CompressBlockWithDict(src, dst, dict, lz4block.Store) }},
+	} {
+		zbuf := make([]byte, lz4block.CompressBlockBound(len(src)))
+		n, err := tc.compress(zbuf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// The text is encoded as literals only.
+		if n <= len(src) {
+			t.Errorf("%s: got %d bytes for %d bytes of text", tc.name, n, len(src))
+		}
+		out := make([]byte, len(src))
+		if _, err := lz4block.UncompressBlock(zbuf[:n], out, nil); err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(out, src) {
+			t.Errorf("%s: uncompressed data does not match original", tc.name)
+		}
+	}
+}
+
+func TestEstimateRatio(t *testing.T) {
+	for _, tc := range rawFiles {
+		src, err := ioutil.ReadFile(tc.file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		zbuf := make([]byte, lz4block.CompressBlockBound(len(src)))
+		n, err := lz4block.CompressBlock(src, zbuf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ratio := float64(n) / float64(len(src))
+		if n == 0 {
+			ratio = 1
+		}
+		// Sampling misses distant matches, so the ratio may be overestimated,
+		// but compressible and incompressible data must be told apart.
+		// Text sampled in windows out of range of each other is barely compressible.
+		est := lz4block.EstimateRatio(src)
+		switch {
+		case est < ratio-0.1:
+			t.Errorf("%s: got ratio %.3f; want at least %.3f", tc.file, est, ratio-0.1)
+		case tc.compressible && est > 0.92:
+			t.Errorf("%s: got ratio %.3f; want at most 0.92", tc.file, est)
+		case !tc.compressible && est < 0.98:
+			t.Errorf("%s: got ratio %.3f; want at least 0.98", tc.file, est)
+		}
+	}
+
+	random := make([]byte, 1<<20)
+	rand.New(rand.NewSource(1)).Read(random)
+	if est := lz4block.EstimateRatio(random); est < 1 {
+		t.Errorf("random data: got ratio %.3f; want at least 1", est)
+	}
+	// Matches more than MaxOffset bytes back cannot be used.
+	periodic := make([]byte, 1<<20)
+	for i := 0; i < len(periodic); i += copy(periodic[i:], random[:128<<10]) {
+	}
+	if est := lz4block.EstimateRatio(periodic); est < 0.98 {
+		t.Errorf("periodic random data: got ratio %.3f; want at least 0.98", est)
+	}
+	if est := lz4block.EstimateRatio(nil); est != 1 {
+		t.Errorf("empty data: got ratio %.3f; want 1", est)
+	}
+}
+
+func TestUncompressBlockErrors(t *testing.T) {
+	// "foo", a match of 4 bytes at offset 3, then "bar".
+	block := []byte("\x30foo\x03\x00\x30bar")
+	far := []byte("\x30foo\x08\x00\x30bar")
+	for _, tc := range []struct {
+		name   string
+		src    []byte
+		dstLen int
+		dict   []byte
+		want   error
+		si, di int
+	}{
+		{"short destination", block, 8, nil, lz4errors.ErrShortDestination, 6, 7},
+		{"truncated", block[:len(block)-1], 10, nil, lz4errors.ErrCorruptBlock, 6, 7},
+		{"offset out of range", far, 10, nil, lz4errors.ErrOffsetOutOfRange, 0, 0},
+		{"offset out of dictionary", far, 10, []byte("dict"), lz4errors.ErrOffsetOutOfRange, 0, 0},
+	} {
+		_, err := lz4block.UncompressBlock(tc.src, make([]byte, tc.dstLen), tc.dict)
+		if err != tc.want || !errors.Is(err, lz4errors.ErrInvalidSourceShortBuffer) {
+			t.Errorf("%s: got %v; want %v", tc.name, err, tc.want)
+			continue
+		}
+		err = lz4block.DiagnoseBlock(tc.src, tc.dstLen, len(tc.dict))
+		var e *lz4errors.BlockError
+		if !errors.As(err, &e) || e.Err != tc.want || e.SrcOffset != tc.si || e.DstOffset != tc.di {
+			t.Errorf("%s: got %v; want %v at offsets %d, %d", tc.name, err, tc.want, tc.si, tc.di)
+		}
+	}
+	if _, err := lz4block.UncompressBlock(far, make([]byte, 10), []byte("dict!")); err != nil {
+		t.Fatal(err)
+	}
+	if err := lz4block.DiagnoseBlock(far, 10, 5); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSequenceScanner(t *testing.T) {
+	src, err := ioutil.ReadFile("../../testdata/pg1661.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	dict := src[:64<<10]
+	block := src[64<<10 : 256<<10]
+
+	var c lz4block.Compressor
+	zbuf := make([]byte, lz4block.CompressBlockBound(len(block)))
+	n, err := c.CompressBlockWithDict(block, zbuf, dict)
+	if err != nil {
+		t.Fatal(err)
+	}
+	zbuf = zbuf[:n]
+
+	// Rebuild the block from its sequences.
+	out := append([]byte(nil), dict...)
+	s := lz4block.NewSequenceScanner(zbuf, len(dict))
+	var last lz4block.Sequence
+	for s.Scan() {
+		seq := s.Sequence()
+		out = append(out, seq.Literals...)
+		for i := 0; i < seq.MatchLen; i++ {
+			out = append(out, out[len(out)-seq.Offset])
+		}
+		last = seq
+	}
+	if err := s.Err(); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(out[len(dict):], block) {
+		t.Fatal("sequences do not match original")
+	}
+	if s.UncompressedLen() != len(block) {
+		t.Fatalf("got uncompressed size %d; want %d", s.UncompressedLen(), len(block))
+	}
+	if last.Offset != 0 || last.MatchLen != 0 {
+		t.Fatalf("last sequence has a match: %+v", last)
+	}
+
+	for _, tc := range []struct {
+		name    string
+		src     []byte
+		dictLen int
+		want    error
+	}{
+		{"no dictionary", zbuf, 0, lz4errors.ErrOffsetOutOfRange},
+		{"truncated", zbuf[:len(zbuf)-1], len(dict), lz4errors.ErrCorruptBlock},
+		{"missing offset", []byte("\x35foo"), 0, lz4errors.ErrCorruptBlock},
+		{"offset beyond dictionary", []byte("\x35foo\x09\x00\x401234"), 5, lz4errors.ErrOffsetOutOfRange},
+	} {
+		s := lz4block.NewSequenceScanner(tc.src, tc.dictLen)
+		for s.Scan() {
+		}
+		if err := s.Err(); !errors.Is(err, tc.want) || !errors.Is(err, lz4errors.ErrInvalidSourceShortBuffer) {
+			t.Errorf("%s: got %v; want %v", tc.name, err, tc.want)
+		}
+	}
+}
+
+func TestUncompressedSize(t *testing.T) {
+	for _, tc := range rawFiles {
+		src, err := ioutil.ReadFile(tc.file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Run(tc.file, func(t *testing.T) {
+			zbuf := make([]byte, lz4block.CompressBlockBound(len(src)))
+			n, err := lz4block.CompressBlock(src, zbuf)
+			if err != nil {
+				t.Fatal(err)
+			}
+			zbuf = zbuf[:n]
+
+			size, err := lz4block.UncompressedSize(zbuf, 0)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if size != len(src) {
+				t.Fatalf("got size %d; want %d", size, len(src))
+			}
+
+			prefix := []byte("prefix")
+			out, err := lz4block.AppendUncompressed(prefix, zbuf, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(out[:len(prefix)], prefix) || !bytes.Equal(out[len(prefix):], src) {
+				t.Fatal("appended data does not match original")
+			}
+
+			// Start the block with a match, which has nothing to reference.
+			if len(zbuf) > 8 {
+				corrupt := append([]byte(nil), zbuf...)
+				corrupt[0] = 0x0F // first sequence is a match
+				if _, err := lz4block.UncompressedSize(corrupt, 0); !errors.Is(err, lz4errors.ErrOffsetOutOfRange) {
+					t.Fatalf("got %v; want %v", err, lz4errors.ErrOffsetOutOfRange)
+				}
+				out, err := lz4block.AppendUncompressed(prefix, corrupt, nil)
+				if !errors.Is(err, lz4errors.ErrOffsetOutOfRange) || !bytes.Equal(out, prefix) {
+					t.Fatalf("got %q, %v; want %q, %v", out, err, prefix, lz4errors.ErrOffsetOutOfRange)
+				}
+			}
+		})
+	}
+}
+
+func TestTrain(t *testing.T) {
+	src, err := ioutil.ReadFile("../../testdata/pg1661.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Train on the paragraphs of the first half and compress the ones of the second half.
+	paragraphs := bytes.Split(src, []byte("\r\n\r\n"))
+	half := len(paragraphs) / 2
+	samples, tests := paragraphs[:half], paragraphs[half:]
+
+	if dict := lz4block.Train(samples[:2], 1<<20); !bytes.Equal(dict, append(append([]byte(nil), samples[0]...), samples[1]...)) {
+		t.Fatalf("got %q; want the samples concatenation", dict)
+	}
+	if dict := lz4block.Train(samples, 0); len(dict) != 0 {
+		t.Fatalf("got %d bytes dictionary; want none", len(dict))
+	}
+
+	for _, size := range []int{1 << 10, 16 << 10, 64 << 10, 1 << 20} {
+		t.Run(fmt.Sprintf("%d", size), func(t *testing.T) {
+			dict := lz4block.Train(samples, size)
+			if len(dict) > size || len(dict) > 64<<10 {
+				t.Fatalf("got %d bytes dictionary; want at most %d", len(dict), size)
+			}
+
+			var c lz4block.Compressor
+			var plainSize, dictSize int
+			buf := make([]byte, lz4block.CompressBlockBound(len(src)))
+			out := make([]byte, len(src))
+			for _, p := range tests {
+				n, err := c.CompressBlock(p, buf)
+				if err != nil {
+					t.Fatal(err)
+				}
+				plainSize += n
+				n, err = c.CompressBlockWithDict(p, buf, dict)
+				if err != nil {
+					t.Fatal(err)
+				}
+				dictSize += n
+				if n == 0 {
+					continue
+				}
+				m, err := lz4block.UncompressBlock(buf[:n], out, dict)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if !bytes.Equal(out[:m], p) {
+					t.Fatal("uncompressed data does not match original")
+				}
+			}
+			if dictSize >= plainSize {
+				t.Fatalf("compressed size with dictionary %d; want less than %d", dictSize, plainSize)
+			}
+		})
+	}
+}
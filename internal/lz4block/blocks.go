@@ -49,6 +49,23 @@ func (b BlockSizeIndex) IsValid() bool {
 	return false
 }
 
+// Size returns the block size of the index, or 0 if it is invalid.
+func (b BlockSizeIndex) Size() uint32 {
+	switch b {
+	case 4:
+		return Block64Kb
+	case 5:
+		return Block256Kb
+	case 6:
+		return Block1Mb
+	case 7:
+		return Block4Mb
+	case 3:
+		return Block8Mb
+	}
+	return 0
+}
+
 func (b BlockSizeIndex) Get() []byte {
 	var buf interface{}
 	switch b {
@@ -85,3 +102,14 @@ func Put(buf []byte) {
 type CompressionLevel uint32
 
 const Fast CompressionLevel = 0
+
+// Compression levels using the optimal parser of CompressorHC.
+// They follow the search depths of Level1 to Level9.
+const (
+	Level10 CompressionLevel = 1 << (18 + iota)
+	Level11
+	Level12
+)
+
+// Store makes CompressorHC encode the blocks as literals only.
+const Store CompressionLevel = 1<<32 - 1
@@ -120,7 +120,8 @@ func decodeBlock(dst, src, dict []byte) (ret int) {
 			// copies from dst[di-offset:] = dst[0:].
 		}
 
-		expanded := dst[di-offset:]
+		// Do not write past the match, so that blocks can be uncompressed in place.
+		expanded := dst[di-offset : di+mLen]
 		if mLen > offset {
 			// Efficiently copy the match dst[di-offset:di] into the dst slice.
 			bytesToCopy := offset * (mLen / offset)
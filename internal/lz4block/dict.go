@@ -0,0 +1,61 @@
+package lz4block
+
+import "sync"
+
+// A Dict holds a dictionary along with the compressor tables indexing it.
+// The tables are built on first use and are never modified afterwards,
+// so a Dict can be shared by multiple goroutines.
+type Dict struct {
+	data []byte
+
+	fastOnce sync.Once
+	fast     *Compressor
+	hcOnce   sync.Once
+	hc       *CompressorHC
+}
+
+// NewDict returns a Dict for the last 64Kb of dict.
+// The dictionary data is copied.
+func NewDict(dict []byte) *Dict {
+	dict = trimDict(dict)
+	return &Dict{data: append([]byte(nil), dict...)}
+}
+
+// Bytes returns the dictionary data used by d.
+func (d *Dict) Bytes() []byte { return d.data }
+
+func (d *Dict) fastTable() *Compressor {
+	d.fastOnce.Do(func() {
+		d.fast = new(Compressor)
+		d.fast.reset()
+		d.fast.index(d.data, 0, len(d.data))
+	})
+	return d.fast
+}
+
+func (d *Dict) hcTables() *CompressorHC {
+	d.hcOnce.Do(func() {
+		d.hc = new(CompressorHC)
+		d.hc.index(d.data, 0, len(d.data))
+	})
+	return d.hc
+}
+
+// trimDict returns the part of dict that can be referenced by a match.
+func trimDict(dict []byte) []byte {
+	if len(dict) > winSize {
+		dict = dict[len(dict)-winSize:]
+	}
+	return dict
+}
+
+// join returns dict followed by src, reusing buf if it is large enough.
+func join(buf, dict, src []byte) []byte {
+	if n := len(dict) + len(src); cap(buf) < n {
+		buf = make([]byte, n)
+	} else {
+		buf = buf[:n]
+	}
+	copy(buf[copy(buf, dict):], src)
+	return buf
+}
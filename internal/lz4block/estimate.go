@@ -0,0 +1,83 @@
+package lz4block
+
+import (
+	"encoding/binary"
+	"math/bits"
+)
+
+const (
+	// Number and size of the windows of src sampled by EstimateRatio.
+	estimateWindows   = 8
+	estimateWindowLen = 1 << 10
+	estimateHashLog   = 12
+)
+
+// EstimateRatio returns an estimate of the ratio of the compressed size of src
+// to its size, as compressed by the fast compressor.
+// It looks for matches in the same way without encoding them, but only within
+// a fixed number of windows spread over src, so that its cost is bounded
+// regardless of the size of src. Distant matches are missed, so the ratio of
+// compressible data is overestimated, but ratios close to or above 1 reliably
+// mean that compressing src is not worth it.
+func EstimateRatio(src []byte) float64 {
+	if len(src) == 0 {
+		return 1
+	}
+	// Positions are stored plus one so that the zero value means none.
+	// The table is shared by all windows so that matches can be found
+	// in the previous ones, as they would be by the compressor, unless
+	// they are too far apart for any match to be in range.
+	var table [1 << estimateHashLog]int32
+
+	stride := len(src) / estimateWindows
+	if stride < estimateWindowLen {
+		// Small inputs are scanned whole.
+		return float64(estimateSize(src, 0, len(src), &table)) / float64(len(src))
+	}
+	var size int
+	for i := 0; i < estimateWindows; i++ {
+		if i > 0 && stride-estimateWindowLen >= MaxOffset {
+			table = [1 << estimateHashLog]int32{}
+		}
+		size += estimateSize(src, i*stride, i*stride+estimateWindowLen, &table)
+	}
+	return float64(size) / float64(estimateWindows*estimateWindowLen)
+}
+
+// estimateSize returns the compressed size of the sequences found in src[start:end].
+func estimateSize(src []byte, start, end int, table *[1 << estimateHashLog]int32) int {
+	// Same as in Compressor.compress.
+	const adaptSkipLog = 7
+
+	var size int
+	si, anchor := start, start
+	sn := end - mfLimit
+	for si < sn {
+		match := binary.LittleEndian.Uint64(src[si:])
+		h := blockHash(match, estimateHashLog)
+		ref := int(table[h]) - 1
+		table[h] = int32(si + 1)
+
+		if ref < 0 || si-ref > MaxOffset || uint32(match) != binary.LittleEndian.Uint32(src[ref:]) {
+			si += 1 + (si-anchor)>>adaptSkipLog
+			continue
+		}
+
+		lLen := si - anchor
+		mStart := si
+		offset := si - ref
+		for si += minMatch; si+8 <= sn; {
+			x := binary.LittleEndian.Uint64(src[si:]) ^ binary.LittleEndian.Uint64(src[si-offset:])
+			if x != 0 {
+				si += bits.TrailingZeros64(x) >> 3
+				break
+			}
+			si += 8
+		}
+		// Token, literals, offset and length extensions.
+		size += 1 + lLen + lLen/0xFF + 2 + (si-mStart)/0xFF
+		anchor = si
+	}
+	lLen := end - anchor
+	return size + 1 + lLen + lLen/0xFF
+}
@@ -0,0 +1,305 @@
+package lz4block
+
+import (
+	"encoding/binary"
+	"math/bits"
+)
+
+// Optimal parsing, used by CompressorHC from Level10.
+//
+// Instead of greedily taking the longest match at each position, the parser
+// finds the cheapest encoding, in bytes, of the data covered by the matches
+// found so far, position by position. This is a port of the reference
+// implementation's LZ4_OPT parser.
+
+const (
+	optNum           = 1 << 12 // maximum number of positions priced at once
+	trailingLiterals = 3
+	lastLiterals     = 5 // the last 5 bytes of a block are always literals
+	minSeqPrice      = 3 // token and offset
+	// decSpeedSeqPrice is the extra price of a sequence when favoring decompression speed,
+	// so that literals are preferred over matches saving a single byte.
+	decSpeedSeqPrice = 1
+)
+
+// optParams are the settings of the optimal parser for a compression level.
+type optParams struct {
+	searches      int  // maximum number of positions to follow in the hash chain
+	sufficientLen int  // matches longer than this are encoded right away
+	fullUpdate    bool // look for matches at all positions
+}
+
+func optLevel(level CompressionLevel) optParams {
+	switch {
+	case level >= Level12:
+		return optParams{16384, optNum - 1, true}
+	case level >= Level11:
+		return optParams{512, 128, false}
+	}
+	return optParams{96, 64, false}
+}
+
+// optimal is the cheapest known way to reach a position:
+// either a literal (mLen == 1) or a match.
+type optimal struct {
+	price  int
+	offset int
+	mLen   int
+	lLen   int // number of literals before the match, or up to the literal
+}
+
+func literalsPrice(lLen int) int { return lLen + lenSize(lLen) }
+
+func sequencePrice(lLen, mLen int) int {
+	return minSeqPrice + literalsPrice(lLen) + lenSize(mLen-minMatch)
+}
+
+// setTrailingLiterals prices the positions following last as literals.
+func setTrailingLiterals(opt []optimal, last int) {
+	for n := 1; n <= trailingLiterals; n++ {
+		opt[last+n] = optimal{price: opt[last].price + literalsPrice(n), mLen: 1, lLen: n}
+	}
+}
+
+// insert adds the positions in [from, to) to the hash and chain tables.
+func (c *CompressorHC) insert(src []byte, from, to int) {
+	for si := from; si < to; si++ {
+		h := blockHashHC(binary.LittleEndian.Uint32(src[si:]))
+		c.chainTable[si&winMask] = c.hashTable[h]
+		c.hashTable[h] = si
+	}
+}
+
+// longestMatch returns the longest match longer than minLen for src[si:limit],
+// following at most searches positions of the hash chain.
+// It returns a zero length if there is none.
+func (c *CompressorHC) longestMatch(src []byte, si, limit, minLen, searches int) (mLen, offset int) {
+	if minLen < minMatch-1 {
+		minLen = minMatch - 1
+	}
+	best := minLen
+	maxOffset := maxOffsetOf(c.MaxOffset)
+	h := blockHashHC(binary.LittleEndian.Uint32(src[si:]))
+	for next, try := c.hashTable[h], searches; try > 0 && next > 0 && si-next <= maxOffset; next, try = c.chainTable[next&winMask], try-1 {
+		if si+best >= limit {
+			break
+		}
+		// The byte at the current best length must match to improve on it.
+		if src[next+best] != src[si+best] {
+			continue
+		}
+		if c.FavorDecSpeed && si-next < 8 {
+			// Overlapping copies do not fit the decoders' fast path.
+			continue
+		}
+		if ml := matchLen(src, next, si, limit); ml > best {
+			best = ml
+			offset = si - next
+		}
+	}
+	if best == minLen {
+		return 0, 0
+	}
+	return best, offset
+}
+
+// matchLen returns the length of the match between src[ref:] and src[si:limit].
+func matchLen(src []byte, ref, si, limit int) int {
+	n := si
+	for n+8 <= limit {
+		x := binary.LittleEndian.Uint64(src[n:]) ^ binary.LittleEndian.Uint64(src[ref+n-si:])
+		if x != 0 {
+			return n - si + bits.TrailingZeros64(x)>>3
+		}
+		n += 8
+	}
+	for n < limit && src[n] == src[ref+n-si] {
+		n++
+	}
+	return n - si
+}
+
+// encodeSequence writes a sequence made of the literals lit and a match into dst.
+// It returns the number of bytes written.
+func encodeSequence(dst, lit []byte, mLen, offset int) int {
+	mLen -= minMatch
+	di := encodeLen(dst, len(lit), mLen)
+	di += copy(dst[di:di+len(lit)], lit)
+	dst[di], dst[di+1] = byte(offset), byte(offset>>8)
+	di += 2
+	if mLen >= 0xF {
+		di += encodeExtLen(dst[di:], mLen-0xF)
+	}
+	return di
+}
+
+// compressOpt is compress for the optimal parsing levels.
+func (c *CompressorHC) compressOpt(src []byte, start int, dst []byte, level CompressionLevel) (int, error) {
+	p := optLevel(level)
+	if c.opt == nil {
+		c.opt = make([]optimal, optNum+trailingLiterals)
+	}
+	opt := c.opt
+
+	// Return 0, nil only if the destination buffer size is < CompressBlockBound.
+	isNotCompressible := len(dst) < CompressBlockBound(len(src)-start)
+
+	var di int
+	si, anchor := start, start
+	sn := len(src) - mfLimit
+	limit := len(src) - lastLiterals
+
+	// When favoring decompression speed, fewer sequences are decoded faster:
+	// they cost more and only replace other paths if they are strictly cheaper.
+	var favor, seqCost int
+	if c.FavorDecSpeed {
+		favor = 1
+		seqCost = decSpeedSeqPrice
+	}
+
+	// Positions are added to the tables lazily, up to the one being searched.
+	indexed := start
+	find := func(si, minLen int) (int, int) {
+		c.insert(src, indexed, si)
+		if si > indexed {
+			indexed = si
+		}
+		mLen, offset := c.longestMatch(src, si, limit, minLen, p.searches)
+		if c.FavorDecSpeed {
+			mLen = favorDecSpeedLen(mLen)
+		}
+		return mLen, offset
+	}
+
+	for si < sn {
+		lLen := si - anchor
+		mLen, offset := find(si, minMatch-1)
+		if mLen == 0 {
+			si++
+			continue
+		}
+		if mLen > p.sufficientLen {
+			// Good enough: encode it right away.
+			di += encodeSequence(dst[di:], src[anchor:si], mLen, offset)
+			si += mLen
+			anchor = si
+			continue
+		}
+
+		// Price the first positions as literals, then the ones covered by the match.
+		for n := 0; n < minMatch; n++ {
+			opt[n] = optimal{price: literalsPrice(lLen + n), mLen: 1, lLen: lLen + n}
+		}
+		for ml := minMatch; ml <= mLen; ml++ {
+			opt[ml] = optimal{price: sequencePrice(lLen, ml) + seqCost, offset: offset, mLen: ml, lLen: lLen}
+		}
+		last := mLen
+		setTrailingLiterals(opt, last)
+
+		// Look for cheaper paths from the following positions.
+		var bestLen, bestOffset int
+		cur := 1
+		for ; cur < last; cur++ {
+			if si+cur >= sn {
+				break
+			}
+			minLen := minMatch - 1
+			if p.fullUpdate {
+				// Even if the next position is not more expensive, the price may rise
+				// sharply after it, so that a short match is still worth it.
+				if opt[cur+1].price <= opt[cur].price && opt[cur+minMatch].price < opt[cur].price+minSeqPrice {
+					continue
+				}
+			} else {
+				// Only look for matches extending beyond the last one, which is faster
+				// but misses a few bytes.
+				if opt[cur+1].price <= opt[cur].price {
+					continue
+				}
+				minLen = last - cur
+			}
+
+			ml, off := find(si+cur, minLen)
+			if ml == 0 {
+				continue
+			}
+			if ml > p.sufficientLen || cur+ml >= optNum {
+				// Encode it right away.
+				bestLen, bestOffset = ml, off
+				last = cur + 1
+				break
+			}
+
+			// Price the literals following the current position.
+			base := opt[cur].lLen
+			for n := 1; n < minMatch; n++ {
+				price := opt[cur].price - literalsPrice(base) + literalsPrice(base+n)
+				if pos := cur + n; price < opt[pos].price {
+					opt[pos] = optimal{price: price, mLen: 1, lLen: base + n}
+				}
+			}
+
+			// Price the positions covered by the match.
+			for n := minMatch; n <= ml; n++ {
+				var price, ll int
+				if opt[cur].mLen == 1 {
+					// The match follows literals: price the whole sequence.
+					ll = opt[cur].lLen
+					if cur > ll {
+						price = opt[cur-ll].price
+					}
+					price += sequencePrice(ll, n) + seqCost
+				} else {
+					price = opt[cur].price + sequencePrice(0, n) + seqCost
+				}
+				if pos := cur + n; pos > last+trailingLiterals || price <= opt[pos].price-favor {
+					if n == ml && last < pos {
+						last = pos
+					}
+					opt[pos] = optimal{price: price, offset: off, mLen: n, lLen: ll}
+				}
+			}
+			setTrailingLiterals(opt, last)
+		}
+		if bestLen == 0 {
+			bestLen, bestOffset = opt[last].mLen, opt[last].offset
+			cur = last - bestLen
+		}
+
+		// Walk the selected path backwards, storing each step at its start position.
+		for pos, ml, off := cur, bestLen, bestOffset; ; {
+			nextLen, nextOffset := opt[pos].mLen, opt[pos].offset
+			opt[pos].mLen, opt[pos].offset = ml, off
+			ml, off = nextLen, nextOffset
+			if ml > pos {
+				break
+			}
+			pos -= ml
+		}
+
+		// Encode the selected sequences.
+		for pos := 0; pos < last; {
+			ml := opt[pos].mLen
+			if ml == 1 {
+				// Literal.
+				si++
+				pos++
+				continue
+			}
+			di += encodeSequence(dst[di:], src[anchor:si], ml, opt[pos].offset)
+			si += ml
+			anchor = si
+			pos += ml
+		}
+	}
+
+	// Last literals.
+	lLen := len(src) - anchor
+	di += encodeLen(dst[di:], lLen, 0)
+	if isNotCompressible && di >= anchor-start {
+		// Incompressible.
+		return 0, nil
+	}
+	di += copy(dst[di:di+lLen], src[anchor:])
+	return di, nil
+}
@@ -0,0 +1,268 @@
+package lz4block
+
+import (
+	"encoding/binary"
+
+	"github.com/pierrec/lz4/v4/internal/lz4errors"
+)
+
+// A sequence is a run of literals followed by a match.
+// The last sequence of a block has no match.
+type sequence struct {
+	lit      int // position of the literals in the block
+	litLen   int
+	offset   int // match offset, 0 for the last sequence
+	matchLen int
+	end      int // position of the next sequence in the block
+}
+
+// readSequence decodes the sequence starting at src[si:].
+// It reports false if the sequence is truncated or invalid.
+func readSequence(src []byte, si int) (seq sequence, ok bool) {
+	if si >= len(src) {
+		return seq, false
+	}
+	b := src[si]
+	si++
+
+	lLen := int(b >> 4)
+	if lLen == 0xF {
+		if lLen, si, ok = readExtLen(src, si, lLen); !ok {
+			return seq, false
+		}
+	}
+	if lLen > len(src)-si {
+		return seq, false
+	}
+	seq.lit, seq.litLen = si, lLen
+	si += lLen
+
+	if si == len(src) {
+		// The last sequence must not have a match.
+		seq.end = si
+		return seq, b&0xF == 0
+	}
+
+	if len(src)-si < 2 {
+		return seq, false
+	}
+	offset := int(binary.LittleEndian.Uint16(src[si:]))
+	if offset == 0 {
+		return seq, false
+	}
+	si += 2
+
+	mLen := int(b & 0xF)
+	if mLen == 0xF {
+		if mLen, si, ok = readExtLen(src, si, mLen); !ok {
+			return seq, false
+		}
+	}
+	seq.offset, seq.matchLen, seq.end = offset, mLen+minMatch, si
+	return seq, true
+}
+
+// readExtLen adds the length extension bytes at src[si:] to n.
+func readExtLen(src []byte, si, n int) (int, int, bool) {
+	for si < len(src) {
+		x := int(src[si])
+		si++
+		if n += x; n < 0 {
+			return 0, 0, false
+		}
+		if x != 0xFF {
+			return n, si, true
+		}
+	}
+	return 0, 0, false
+}
+
+// blockError returns the error of the given kind for the sequence at src[si:] and dst[di:].
+func blockError(kind lz4errors.BlockErrorKind, si, di int) error {
+	return &lz4errors.BlockError{Err: kind, SrcOffset: si, DstOffset: di}
+}
+
+// decodeFailure locates the first sequence of the block src that cannot be
+// uncompressed into dstLen bytes with a dictionary of dictLen bytes.
+// It returns its offsets and the kind of error, which is nil if there is none.
+func decodeFailure(src []byte, dstLen, dictLen int) (si, di int, err error) {
+	for si < len(src) {
+		seq, ok := readSequence(src, si)
+		switch {
+		case !ok:
+			return si, di, lz4errors.ErrCorruptBlock
+		case seq.litLen+seq.matchLen > dstLen-di:
+			return si, di, lz4errors.ErrShortDestination
+		case seq.offset > di+seq.litLen+dictLen:
+			return si, di, lz4errors.ErrOffsetOutOfRange
+		}
+		si, di = seq.end, di+seq.litLen+seq.matchLen
+	}
+	return si, di, nil
+}
+
+// decodeError returns the kind of error explaining why the block src cannot be
+// uncompressed into dstLen bytes with a dictionary of dictLen bytes.
+// The offsets are left out so that failing does not allocate.
+func decodeError(src []byte, dstLen, dictLen int) error {
+	if _, _, err := decodeFailure(src, dstLen, dictLen); err != nil {
+		return err
+	}
+	return lz4errors.ErrCorruptBlock
+}
+
+// DiagnoseBlock returns nil if the block src can be uncompressed into dstLen bytes
+// with a dictionary of dictLen bytes, or a BlockError locating the sequence that cannot.
+func DiagnoseBlock(src []byte, dstLen, dictLen int) error {
+	si, di, err := decodeFailure(src, dstLen, dictLen)
+	if err == nil {
+		return nil
+	}
+	return blockError(err.(lz4errors.BlockErrorKind), si, di)
+}
+
+// uncompressPartial is UncompressBlockPartial with 0 < targetSize <= len(dst).
+// The sequences that fit entirely within targetSize are uncompressed by decodeBlock,
+// the last one is finished here.
+func uncompressPartial(src, dst, dict []byte, targetSize int) (int, error) {
+	var (
+		seq    sequence
+		si, di int
+	)
+	for si < len(src) {
+		var ok bool
+		if seq, ok = readSequence(src, si); !ok {
+			return 0, lz4errors.ErrCorruptBlock
+		}
+		n := di + seq.litLen + seq.matchLen
+		if n > targetSize {
+			break
+		}
+		si, di = seq.end, n
+	}
+	if si > 0 && decodeBlock(dst[:targetSize], src[:si], dict) != di {
+		return 0, decodeError(src[:si], targetSize, len(dict))
+	}
+	if si == len(src) || di == targetSize {
+		return di, nil
+	}
+
+	di += copy(dst[di:targetSize], src[seq.lit:seq.lit+seq.litLen])
+	for mLen := seq.matchLen; mLen > 0 && di < targetSize; mLen-- {
+		if i := di - seq.offset; i >= 0 {
+			dst[di] = dst[i]
+		} else if i += len(dict); i >= 0 {
+			dst[di] = dict[i]
+		} else {
+			return 0, lz4errors.ErrOffsetOutOfRange
+		}
+		di++
+	}
+	return di, nil
+}
+
+// blockSize returns the size of the block at the start of src uncompressing to n bytes.
+// The block ends with the literals reaching n bytes, whatever follows it in src.
+// Offsets are not validated.
+func blockSize(src []byte, n int) (int, error) {
+	var si, di int
+	for si < len(src) {
+		b := src[si]
+		si++
+
+		lLen := int(b >> 4)
+		if lLen == 0xF {
+			var ok bool
+			if lLen, si, ok = readExtLen(src, si, lLen); !ok {
+				return 0, lz4errors.ErrCorruptBlock
+			}
+		}
+		if lLen > len(src)-si {
+			return 0, lz4errors.ErrCorruptBlock
+		}
+		if lLen > n-di {
+			return 0, lz4errors.ErrShortDestination
+		}
+		si += lLen
+		if di += lLen; di == n {
+			// The last sequence must not have a match.
+			if b&0xF != 0 {
+				return 0, lz4errors.ErrCorruptBlock
+			}
+			return si, nil
+		}
+
+		if len(src)-si < 2 {
+			return 0, lz4errors.ErrCorruptBlock
+		}
+		si += 2
+		mLen := int(b & 0xF)
+		if mLen == 0xF {
+			var ok bool
+			if mLen, si, ok = readExtLen(src, si, mLen); !ok {
+				return 0, lz4errors.ErrCorruptBlock
+			}
+		}
+		if mLen += minMatch; mLen > n-di {
+			return 0, lz4errors.ErrShortDestination
+		}
+		di += mLen
+	}
+	return 0, lz4errors.ErrCorruptBlock
+}
+
+// A Sequence is a run of literals followed by a match.
+type Sequence struct {
+	Literals []byte // the literals, part of the block
+	Offset   int    // match offset, 0 for the last sequence of a block
+	MatchLen int    // match length, 0 for the last sequence of a block
+}
+
+// A SequenceScanner iterates over the sequences of a block.
+type SequenceScanner struct {
+	src     []byte
+	dictLen int
+	si, di  int
+	seq     Sequence
+	err     error
+}
+
+// NewSequenceScanner returns a SequenceScanner for the block src.
+// Matches may reference up to dictLen bytes before the block.
+func NewSequenceScanner(src []byte, dictLen int) *SequenceScanner {
+	return &SequenceScanner{src: src, dictLen: dictLen}
+}
+
+// Scan advances to the next sequence and reports whether there is one.
+// It returns false at the end of the block or on error.
+func (s *SequenceScanner) Scan() bool {
+	if s.err != nil || s.si >= len(s.src) {
+		return false
+	}
+	seq, ok := readSequence(s.src, s.si)
+	if !ok {
+		s.err = blockError(lz4errors.ErrCorruptBlock, s.si, s.di)
+		return false
+	}
+	if seq.offset > s.di+seq.litLen+s.dictLen {
+		s.err = blockError(lz4errors.ErrOffsetOutOfRange, s.si, s.di)
+		return false
+	}
+	s.seq = Sequence{
+		Literals: s.src[seq.lit : seq.lit+seq.litLen],
+		Offset:   seq.offset,
+		MatchLen: seq.matchLen,
+	}
+	s.si = seq.end
+	s.di += seq.litLen + seq.matchLen
+	return true
+}
+
+// Sequence returns the current sequence.
+func (s *SequenceScanner) Sequence() Sequence { return s.seq }
+
+// Err returns the first error encountered.
+func (s *SequenceScanner) Err() error { return s.err }
+
+// UncompressedLen returns the uncompressed size of the sequences scanned so far.
+func (s *SequenceScanner) UncompressedLen() int { return s.di }
@@ -0,0 +1,256 @@
+package lz4block
+
+// A StreamCompressor compresses a sequence of dependent blocks:
+// each block may reference the previous 64Kb of data compressed by the same StreamCompressor.
+type StreamCompressor struct {
+	// Acceleration trades compression ratio for speed: the higher the faster.
+	// Values < 1 mean 1.
+	Acceleration int
+	// HashLog is the base 2 logarithm of the number of hash table entries.
+	// Values < 1 mean 16, others are capped to [MinHashLog, MaxHashLog].
+	HashLog int
+	// MaxOffset is the largest match offset, as for Compressor.
+	MaxOffset int
+
+	c Compressor
+	// History of the data compressed so far followed by the block being compressed.
+	hist []byte
+}
+
+// Reset discards the history of s.
+func (s *StreamCompressor) Reset() {
+	s.c.reset()
+	s.hist = s.hist[:0]
+}
+
+func (s *StreamCompressor) CompressBlock(src, dst []byte) (int, error) {
+	// Table entries only store positions modulo winSize, so sliding the history
+	// by a multiple of winSize keeps them valid.
+	s.hist, _ = slideHistory(s.hist)
+	s.c.HashLog = s.HashLog
+	if s.c.hashLog == 0 || s.c.hashLog != hashLogOf(s.HashLog) {
+		// New hash table: index the history again.
+		s.c.reset()
+		s.c.index(s.hist, 0, len(s.hist))
+	}
+	start := len(s.hist)
+	s.hist = append(s.hist, src...)
+	s.c.Acceleration = s.Acceleration
+	s.c.MaxOffset = s.MaxOffset
+	return s.c.compress(s.hist, start, dst)
+}
+
+// add appends src to the history without compressing it.
+func (s *StreamCompressor) add(src []byte) {
+	s.hist, _ = slideHistory(s.hist)
+	start := len(s.hist)
+	s.hist = append(s.hist, src...)
+	if s.c.hashLog == hashLogOf(s.HashLog) {
+		// Otherwise the history is indexed again by the next block.
+		s.c.index(s.hist, windowStart(s.hist, start), len(s.hist))
+	}
+}
+
+// A StreamCompressorHC is the high compression version of StreamCompressor.
+type StreamCompressorHC struct {
+	// MaxOffset is the largest match offset, as for Compressor.
+	MaxOffset int
+	// FavorDecSpeed is as for CompressorHC.
+	FavorDecSpeed bool
+
+	c    CompressorHC
+	hist []byte
+}
+
+// Reset discards the history of s.
+func (s *StreamCompressorHC) Reset() {
+	s.c.reset()
+	s.hist = s.hist[:0]
+}
+
+func (s *StreamCompressorHC) CompressBlock(src, dst []byte, depth CompressionLevel) (int, error) {
+	var shift int
+	s.hist, shift = slideHistory(s.hist)
+	if shift > 0 {
+		s.c.shift(shift)
+	}
+	s.c.needsReset = true
+	start := len(s.hist)
+	s.hist = append(s.hist, src...)
+	s.c.MaxOffset = s.MaxOffset
+	s.c.FavorDecSpeed = s.FavorDecSpeed
+	return s.c.compress(s.hist, start, dst, depth)
+}
+
+// add appends src to the history without compressing it.
+func (s *StreamCompressorHC) add(src []byte) {
+	var shift int
+	s.hist, shift = slideHistory(s.hist)
+	if shift > 0 {
+		s.c.shift(shift)
+	}
+	s.c.needsReset = true
+	start := len(s.hist)
+	s.hist = append(s.hist, src...)
+	s.c.index(s.hist, windowStart(s.hist, start), len(s.hist))
+}
+
+// windowStart returns the start of the positions of hist[start:] that the next block may reference.
+func windowStart(hist []byte, start int) int {
+	if n := len(hist) - winSize; n > start {
+		return n
+	}
+	return start
+}
+
+// A LinkedCompressor compresses the dependent blocks of a frame.
+// Its stream compressor keeps its tables from one block to the next,
+// instead of indexing the previous blocks again for every block.
+type LinkedCompressor struct {
+	p    Params
+	fast *StreamCompressor
+	hc   *StreamCompressorHC
+}
+
+// Reset sets up l to compress with p, its history starting with dict.
+// The stream compressors are allocated on first use and then kept.
+func (l *LinkedCompressor) Reset(p Params, dict []byte) {
+	l.p = p
+	switch {
+	case p.Store:
+	case p.Level == Fast:
+		if l.fast == nil {
+			l.fast = new(StreamCompressor)
+		}
+		l.fast.Acceleration, l.fast.HashLog, l.fast.MaxOffset = p.Acceleration, p.HashLog, p.MaxOffset
+		l.fast.Reset()
+		l.fast.add(dict)
+	default:
+		if l.hc == nil {
+			l.hc = new(StreamCompressorHC)
+		}
+		l.hc.MaxOffset, l.hc.FavorDecSpeed = p.MaxOffset, p.FavorDecSpeed
+		l.hc.Reset()
+		l.hc.add(dict)
+	}
+}
+
+// CompressBlock compresses src into dst, or only adds it to the history
+// and encodes it as literals if store is set.
+func (l *LinkedCompressor) CompressBlock(src, dst []byte, store bool) (int, error) {
+	switch {
+	case l.p.Store:
+	case l.p.Level == Fast && store:
+		l.fast.add(src)
+	case l.p.Level == Fast:
+		return l.fast.CompressBlock(src, dst)
+	case store:
+		l.hc.add(src)
+	default:
+		return l.hc.CompressBlock(src, dst, l.p.Level)
+	}
+	return storeBlock(src, dst)
+}
+
+// shift moves all positions in the tables n bytes back, dropping the ones that fall off.
+func (c *CompressorHC) shift(n int) {
+	for i, p := range c.hashTable {
+		if p -= n; p < 0 {
+			p = 0
+		}
+		c.hashTable[i] = p
+	}
+	for i, p := range c.chainTable {
+		if p -= n; p < 0 {
+			p = 0
+		}
+		c.chainTable[i] = p
+	}
+}
+
+// slideHistory discards the start of hist once it holds at least twice the window size,
+// keeping at least a full window.
+// The number of discarded bytes is a multiple of winSize so that positions modulo winSize
+// are preserved.
+func slideHistory(hist []byte) ([]byte, int) {
+	if len(hist) < 2*winSize {
+		return hist, 0
+	}
+	shift := (len(hist) - winSize) &^ winMask
+	n := copy(hist, hist[shift:])
+	return hist[:n], shift
+}
+
+// A StreamDecompressor uncompresses a sequence of dependent blocks.
+// It keeps the last 64Kb of uncompressed data to be used as dictionary by the next block.
+// That data is referenced where it was uncompressed, and only copied when the next
+// block does not follow it in memory and is too small to replace it.
+type StreamDecompressor struct {
+	hist []byte
+	// Whether hist is held in buf rather than referencing the caller's data.
+	own bool
+	buf []byte
+}
+
+// Reset discards the history of s.
+func (s *StreamDecompressor) Reset() { s.hist, s.own = nil, false }
+
+// Dict returns the history to be used as dictionary for the next block.
+func (s *StreamDecompressor) Dict() []byte { return s.hist }
+
+func (s *StreamDecompressor) UncompressBlock(src, dst []byte) (int, error) {
+	n, err := UncompressBlock(src, dst, s.hist)
+	if err != nil {
+		return 0, err
+	}
+	s.AddUncompressed(dst[:n])
+	return n, nil
+}
+
+// AddUncompressed appends data to the history.
+// It is used for blocks stored uncompressed.
+// The history may reference data, which must then be left unchanged until
+// the next block is added.
+func (s *StreamDecompressor) AddUncompressed(data []byte) {
+	switch {
+	case len(data) >= winSize:
+		s.hist, s.own = data[len(data)-winSize:], false
+	case len(s.hist) == 0:
+		s.hist, s.own = data, false
+	case !s.own && follows(s.hist, data):
+		s.hist = trimDict(s.hist[:len(s.hist)+len(data)])
+	default:
+		s.CopyUncompressed(data)
+	}
+}
+
+// CopyUncompressed is like AddUncompressed but copies data,
+// so that it can be modified afterwards.
+func (s *StreamDecompressor) CopyUncompressed(data []byte) {
+	if s.buf == nil {
+		s.buf = make([]byte, 0, 2*winSize)
+	}
+	if len(data) >= winSize {
+		s.hist, s.own = append(s.buf[:0], data[len(data)-winSize:]...), true
+		return
+	}
+	if !s.own {
+		// Keep the part of the referenced history that data does not replace.
+		hist := s.hist
+		if n := winSize - len(data); len(hist) > n {
+			hist = hist[len(hist)-n:]
+		}
+		s.hist, s.own = append(s.buf[:0], hist...), true
+	}
+	if len(s.hist)+len(data) > cap(s.hist) {
+		// Only keep what is needed to fill the window with data.
+		n := copy(s.hist, s.hist[len(s.hist)-(winSize-len(data)):])
+		s.hist = s.hist[:n]
+	}
+	s.hist = append(s.hist, data...)
+}
+
+// follows reports whether b starts right after the end of a in memory.
+func follows(a, b []byte) bool {
+	return len(b) > 0 && cap(a) > len(a) && &a[:len(a)+1][len(a)] == &b[0]
+}
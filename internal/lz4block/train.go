@@ -0,0 +1,164 @@
+package lz4block
+
+import "encoding/binary"
+
+// Dictionary training.
+//
+// The dictionary is made of the segments of the samples that contain the most
+// frequent dmers (short substrings long enough to be a match), where the frequency
+// of a dmer is the number of samples it appears in.
+// This is the COVER algorithm used to train zstd dictionaries:
+// the samples are split into epochs, one segment being selected per epoch, and
+// the dmers of a selected segment no longer count towards the following selections.
+// The first selected segments end up at the end of the dictionary, where they
+// are closer to the data and last longer in the window of dependent blocks.
+
+const (
+	dmerLen = 6   // length of the substrings counted, a bit more than minMatch
+	segLen  = 256 // length of the dictionary segments
+)
+
+// dmer returns the dmer at the start of b.
+func dmer(b []byte) uint64 {
+	return uint64(binary.LittleEndian.Uint32(b)) | uint64(binary.LittleEndian.Uint16(b[4:]))<<32
+}
+
+// Train returns a dictionary of at most size bytes, capped to 64Kb, built from samples.
+func Train(samples [][]byte, size int) []byte {
+	if size > winSize {
+		size = winSize
+	}
+	if size <= 0 {
+		return nil
+	}
+
+	var total int
+	for _, s := range samples {
+		total += len(s)
+	}
+	if total <= size {
+		// Not enough data to choose from.
+		dict := make([]byte, 0, total)
+		for _, s := range samples {
+			dict = append(dict, s...)
+		}
+		return dict
+	}
+
+	// Concatenate the samples and count the samples each dmer appears in.
+	type dmerInfo struct {
+		freq int // number of samples containing the dmer
+		last int // last sample where the dmer was found, plus one
+	}
+	data := make([]byte, 0, total)
+	ends := make([]int, 0, len(samples)) // end of each sample in data
+	dmers := make(map[uint64]dmerInfo)
+	for i, s := range samples {
+		for p := 0; p+dmerLen <= len(s); p++ {
+			k := dmer(s[p:])
+			if d := dmers[k]; d.last != i+1 {
+				dmers[k] = dmerInfo{d.freq + 1, i + 1}
+			}
+		}
+		data = append(data, s...)
+		ends = append(ends, len(data))
+	}
+
+	// valid reports whether the dmer at p is within a sample.
+	sample := 0
+	valid := func(p int) bool {
+		for sample < len(ends) && ends[sample] <= p {
+			sample++
+		}
+		for sample > 0 && ends[sample-1] > p {
+			sample--
+		}
+		return sample < len(ends) && p+dmerLen <= ends[sample]
+	}
+	freq := func(p int) int {
+		if !valid(p) {
+			return 0
+		}
+		return dmers[dmer(data[p:])].freq
+	}
+
+	epochs := size / segLen
+	if epochs < 1 {
+		epochs = 1
+	}
+	epochLen := len(data) / epochs
+	seg := segLen
+	if seg > size {
+		seg = size
+	}
+	if seg > epochLen {
+		seg = epochLen
+	}
+
+	dict := make([]byte, size)
+	tail := size
+	active := make(map[uint64]int) // number of occurrences of the dmers in the window
+	for e, empty := 0, 0; tail > 0 && empty < epochs; e = (e + 1) % epochs {
+		// Find the segment of the epoch with the highest score, which is the
+		// sum of the frequencies of its distinct dmers.
+		begin, end := e*epochLen, (e+1)*epochLen
+		for k := range active {
+			delete(active, k)
+		}
+		var score, best, bestStart int
+		for p := begin; p+dmerLen <= end; p++ {
+			if valid(p) {
+				k := dmer(data[p:])
+				if active[k] == 0 {
+					score += dmers[k].freq
+				}
+				active[k]++
+			}
+			// Window of dmers starting in [start, p].
+			start := p - (seg - dmerLen)
+			if start < begin {
+				continue
+			}
+			if score > best {
+				best, bestStart = score, start
+			}
+			if valid(start) {
+				k := dmer(data[start:])
+				if active[k]--; active[k] == 0 {
+					score -= dmers[k].freq
+				}
+			}
+		}
+		if best == 0 {
+			empty++
+			continue
+		}
+		empty = 0
+
+		// Trim the dmers that are not useful anymore on both ends.
+		segStart, segEnd := bestStart, bestStart+seg-dmerLen
+		for segStart < segEnd && freq(segStart) == 0 {
+			segStart++
+		}
+		for segEnd > segStart && freq(segEnd) == 0 {
+			segEnd--
+		}
+		segEnd += dmerLen
+		// The selected dmers do not count anymore.
+		for p := segStart; p+dmerLen <= segEnd; p++ {
+			if valid(p) {
+				k := dmer(data[p:])
+				dmers[k] = dmerInfo{0, dmers[k].last}
+			}
+		}
+
+		n := segEnd - segStart
+		if n > tail {
+			segStart = segEnd - tail
+			n = tail
+		}
+		tail -= n
+		copy(dict[tail:], data[segStart:segEnd])
+	}
+	return dict[tail:]
+}
@@ -1,5 +1,7 @@
 package lz4errors
 
+import "fmt"
+
 type Error string
 
 func (e Error) Error() string { return string(e) }
@@ -16,4 +18,36 @@ const (
 	ErrOptionInvalidBlockSize        Error = "lz4: invalid block size"
 	ErrOptionNotApplicable           Error = "lz4: option not applicable"
 	ErrWriterNotClosed               Error = "lz4: writer not closed"
+	ErrWriterClosed                  Error = "lz4: writer closed"
+	ErrOptionInvalidHashLog          Error = "lz4: invalid hash table size"
+	ErrOptionInvalidMaxOffset        Error = "lz4: invalid maximum match offset"
+	ErrInvalidSkippableFrame         Error = "lz4: invalid skippable frame"
+	ErrDictionaryNotFound            Error = "lz4: dictionary not found"
+)
+
+// BlockErrorKind is the type of the errors returned when a block cannot be processed.
+// They all match ErrInvalidSourceShortBuffer with errors.Is.
+type BlockErrorKind string
+
+func (e BlockErrorKind) Error() string { return string(e) }
+
+func (e BlockErrorKind) Is(target error) bool { return target == ErrInvalidSourceShortBuffer }
+
+const (
+	ErrShortDestination BlockErrorKind = "lz4: destination buffer too short"
+	ErrCorruptBlock     BlockErrorKind = "lz4: corrupt block"
+	ErrOffsetOutOfRange BlockErrorKind = "lz4: match offset out of range"
 )
+
+// BlockError records the position in the block where an error occurred.
+type BlockError struct {
+	Err       BlockErrorKind
+	SrcOffset int // offset in the source of the sequence that failed
+	DstOffset int // offset in the destination of the sequence that failed
+}
+
+func (e *BlockError) Error() string {
+	return fmt.Sprintf("%v at source offset %d, destination offset %d", e.Err, e.SrcOffset, e.DstOffset)
+}
+
+func (e *BlockError) Unwrap() error { return e.Err }
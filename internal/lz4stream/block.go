@@ -92,7 +92,7 @@ func (b *Blocks) ErrorR() error {
 //
 // If not in concurrent mode, the uncompressed block is b.Block and the returned error
 // needs to be checked.
-func (b *Blocks) initR(f *Frame, num int, src io.Reader) (chan []byte, error) {
+func (b *Blocks) initR(f *Frame, num int, src io.Reader, dict []byte) (chan []byte, error) {
 	size := f.Descriptor.Flags.BlockSizeIndex()
 	if num == 1 {
 		b.Blocks = nil
@@ -127,7 +127,7 @@ func (b *Blocks) initR(f *Frame, num int, src io.Reader) (chan []byte, error) {
 			blocks <- c
 			go func() {
 				defer block.Close(f)
-				data, err := block.Uncompress(f, size.Get(), nil, false)
+				data, err := block.Uncompress(f, size.Get(), dict, false)
 				if err != nil {
 					b.closeR(err)
 					// Close the block channel to indicate an error.
@@ -142,7 +142,7 @@ func (b *Blocks) initR(f *Frame, num int, src io.Reader) (chan []byte, error) {
 		blocks <- c
 		c <- nil // signal the collection loop that we are done
 		<-c      // wait for the collect loop to complete
-		if f.isLegacy() && cum == cumx {
+		if f.IsLegacy() && cum == cumx {
 			err = io.EOF
 		}
 		b.closeR(err)
@@ -180,7 +180,7 @@ func (b *Blocks) initR(f *Frame, num int, src io.Reader) (chan []byte, error) {
 			data <- buf
 			close(c)
 		}
-	}(f.isLegacy())
+	}(f.IsLegacy())
 	return data, nil
 }
 
@@ -221,20 +221,22 @@ func (b *FrameDataBlock) Close(f *Frame) {
 }
 
 // Block compression errors are ignored since the buffer is sized appropriately.
-func (b *FrameDataBlock) Compress(f *Frame, src []byte, level lz4block.CompressionLevel) *FrameDataBlock {
+// Matches may reference dict, the data preceding src for dependent blocks.
+func (b *FrameDataBlock) Compress(f *Frame, src, dict []byte, params lz4block.Params) *FrameDataBlock {
+	return b.CompressWith(f, src, func(src, dst []byte) (int, error) {
+		return params.CompressBlockWithDict(src, dst, dict)
+	})
+}
+
+// CompressWith is like Compress but compresses src with the given block compression function.
+func (b *FrameDataBlock) CompressWith(f *Frame, src []byte, compress func(src, dst []byte) (int, error)) *FrameDataBlock {
 	data := b.data
-	if f.isLegacy() {
+	if f.IsLegacy() {
 		data = data[:cap(data)]
 	} else {
 		data = data[:len(src)] // trigger the incompressible flag in CompressBlock
 	}
-	var n int
-	switch level {
-	case lz4block.Fast:
-		n, _ = lz4block.CompressBlock(src, data)
-	default:
-		n, _ = lz4block.CompressBlockHC(src, data, level)
-	}
+	n, _ := compress(src, data)
 	if n == 0 {
 		b.Size.UncompressedSet(true)
 		b.Data = src
@@ -281,7 +283,7 @@ func (b *FrameDataBlock) Read(f *Frame, src io.Reader, cum uint32) (uint32, erro
 	if err != nil {
 		return 0, err
 	}
-	if f.isLegacy() {
+	if f.IsLegacy() {
 		switch x {
 		case frameMagicLegacy:
 			// Concatenated legacy frame.
@@ -306,6 +308,7 @@ func (b *FrameDataBlock) Read(f *Frame, src io.Reader, cum uint32) (uint32, erro
 	if _, err := io.ReadFull(src, b.data); err != nil {
 		return x, err
 	}
+	b.Data = b.data
 	if f.Descriptor.Flags.BlockChecksum() {
 		sum, err := f.readUint32(src)
 		if err != nil {
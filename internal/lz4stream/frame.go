@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"io"
 	"io/ioutil"
+	"math"
 
 	"github.com/pierrec/lz4/v4/internal/lz4block"
 	"github.com/pierrec/lz4/v4/internal/lz4errors"
@@ -25,7 +26,7 @@ func NewFrame() *Frame {
 }
 
 type Frame struct {
-	buf        [15]byte // frame descriptor needs at most 4(magic)+4+8+1=11 bytes
+	buf        [19]byte // frame descriptor needs at most 4(magic)+2+8+4+1=19 bytes
 	Magic      uint32
 	Descriptor FrameDescriptor
 	Blocks     Blocks
@@ -60,7 +61,7 @@ func (f *Frame) CloseW(dst io.Writer, num int) error {
 	if err := f.Blocks.close(f, num); err != nil {
 		return err
 	}
-	if f.isLegacy() {
+	if f.IsLegacy() {
 		return nil
 	}
 	buf := f.buf[:0]
@@ -73,21 +74,70 @@ func (f *Frame) CloseW(dst io.Writer, num int) error {
 	return err
 }
 
-func (f *Frame) isLegacy() bool {
+func (f *Frame) IsLegacy() bool {
 	return f.Magic == frameMagicLegacy
 }
 
-func (f *Frame) ParseHeaders(src io.Reader) error {
+// CheckSkippable returns an error if a skippable frame cannot have the given
+// magic nibble and payload size.
+func CheckSkippable(nibble uint8, size int) error {
+	if nibble > 0xF || uint64(size) > math.MaxUint32 {
+		return lz4errors.ErrInvalidSkippableFrame
+	}
+	return nil
+}
+
+// WriteSkippable writes a skippable frame with the given magic nibble and payload,
+// which must be valid according to CheckSkippable.
+func WriteSkippable(dst io.Writer, nibble uint8, payload []byte) error {
+	var buf [8]byte
+	binary.LittleEndian.PutUint32(buf[:], frameSkipMagic|uint32(nibble))
+	binary.LittleEndian.PutUint32(buf[4:], uint32(len(payload)))
+	if _, err := dst.Write(buf[:]); err != nil {
+		return err
+	}
+	_, err := dst.Write(payload)
+	return err
+}
+
+// ParseHeaders reads the headers of the next LZ4 frame.
+// The skippable frames preceding it are passed to onSkip if not nil, and discarded otherwise.
+func (f *Frame) ParseHeaders(src io.Reader, onSkip func(nibble uint8, payload io.Reader) error) error {
 	if f.Magic > 0 {
 		// Header already read.
 		return nil
 	}
+	return f.parseHeaders(src, onSkip, false)
+}
 
+// ParseNextHeaders reads the headers of the LZ4 frame following the one that was just read
+// from src, as ParseHeaders does. It returns io.EOF if there is none, including when the
+// remaining data is only made of zero bytes.
+// Concatenated legacy frames are read as a single one.
+func (f *Frame) ParseNextHeaders(src io.Reader, num int, onSkip func(nibble uint8, payload io.Reader) error) error {
+	if f.IsLegacy() {
+		return io.EOF
+	}
+	// The blocks of a frame read concurrently end with io.EOF.
+	if err := f.Blocks.close(f, num); err != nil && err != io.EOF {
+		return err
+	}
+	f.Checksum = 0
+	return f.parseHeaders(src, onSkip, true)
+}
+
+func (f *Frame) parseHeaders(src io.Reader, onSkip func(nibble uint8, payload io.Reader) error, next bool) error {
 newFrame:
-	var err error
-	if f.Magic, err = f.readUint32(src); err != nil {
+	buf := f.buf[:4]
+	n, err := io.ReadFull(src, buf)
+	if next && n > 0 && (err == nil || err == io.ErrUnexpectedEOF) && isZeroes(buf[:n]) {
+		// Padding at the end of the stream.
+		return f.skipZeroes(src)
+	}
+	if err != nil {
 		return err
 	}
+	f.Magic = binary.LittleEndian.Uint32(buf)
 	switch m := f.Magic; {
 	case m == frameMagic || m == frameMagicLegacy:
 	// All 16 values of frameSkipMagic are valid.
@@ -96,9 +146,19 @@ newFrame:
 		if err != nil {
 			return err
 		}
-		if _, err := io.CopyN(ioutil.Discard, src, int64(skip)); err != nil {
+		payload := &io.LimitedReader{R: src, N: int64(skip)}
+		if onSkip != nil {
+			if err := onSkip(uint8(m&0xF), payload); err != nil {
+				return err
+			}
+		}
+		// Discard whatever the handler did not read.
+		if _, err := io.Copy(ioutil.Discard, payload); err != nil {
 			return err
 		}
+		if payload.N > 0 {
+			return io.ErrUnexpectedEOF
+		}
 		goto newFrame
 	default:
 		return lz4errors.ErrInvalidFrame
@@ -110,12 +170,36 @@ newFrame:
 	return nil
 }
 
-func (f *Frame) InitR(src io.Reader, num int) (chan []byte, error) {
-	return f.Blocks.initR(f, num, src)
+// skipZeroes reads src until its end, which must only contain zero bytes, and returns io.EOF.
+func (f *Frame) skipZeroes(src io.Reader) error {
+	for {
+		n, err := src.Read(f.buf[:])
+		if !isZeroes(f.buf[:n]) {
+			return lz4errors.ErrInvalidFrame
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+func isZeroes(buf []byte) bool {
+	for _, c := range buf {
+		if c != 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// InitR sets up the reading of the blocks.
+// Matches of independent blocks may reference dict.
+func (f *Frame) InitR(src io.Reader, num int, dict []byte) (chan []byte, error) {
+	return f.Blocks.initR(f, num, src, dict)
 }
 
 func (f *Frame) CloseR(src io.Reader) (err error) {
-	if f.isLegacy() {
+	if f.IsLegacy() {
 		return nil
 	}
 	if !f.Descriptor.Flags.ContentChecksum() {
@@ -133,12 +217,12 @@ func (f *Frame) CloseR(src io.Reader) (err error) {
 type FrameDescriptor struct {
 	Flags       DescriptorFlags
 	ContentSize uint64
+	DictID      uint32
 	Checksum    uint8
 }
 
 func (fd *FrameDescriptor) initW() {
 	fd.Flags.VersionSet(1)
-	fd.Flags.BlockIndependenceSet(true)
 }
 
 func (fd *FrameDescriptor) Write(f *Frame, dst io.Writer) error {
@@ -150,13 +234,17 @@ func (fd *FrameDescriptor) Write(f *Frame, dst io.Writer) error {
 	buf := f.buf[:4]
 	// Write the magic number here even though it belongs to the Frame.
 	binary.LittleEndian.PutUint32(buf, f.Magic)
-	if !f.isLegacy() {
+	if !f.IsLegacy() {
 		buf = buf[:4+2]
 		binary.LittleEndian.PutUint16(buf[4:], uint16(fd.Flags))
 
 		if fd.Flags.Size() {
-			buf = buf[:4+2+8]
-			binary.LittleEndian.PutUint64(buf[4+2:], fd.ContentSize)
+			buf = buf[:len(buf)+8]
+			binary.LittleEndian.PutUint64(buf[len(buf)-8:], fd.ContentSize)
+		}
+		if fd.Flags.DictID() {
+			buf = buf[:len(buf)+4]
+			binary.LittleEndian.PutUint32(buf[len(buf)-4:], fd.DictID)
 		}
 		fd.Checksum = descriptorChecksum(buf[4:])
 		buf = append(buf, fd.Checksum)
@@ -167,12 +255,14 @@ func (fd *FrameDescriptor) Write(f *Frame, dst io.Writer) error {
 }
 
 func (fd *FrameDescriptor) initR(f *Frame, src io.Reader) error {
-	if f.isLegacy() {
+	// Clear the fields of any previous frame.
+	fd.Flags, fd.ContentSize, fd.DictID = 0, 0, 0
+	if f.IsLegacy() {
 		idx := lz4block.Index(lz4block.Block8Mb)
 		f.Descriptor.Flags.BlockSizeIndexSet(idx)
 		return nil
 	}
-	// Read the flags and the checksum, hoping that there is not content size.
+	// Read the flags and the checksum, hoping that there is no content size nor dictionary ID.
 	buf := f.buf[:3]
 	if _, err := io.ReadFull(src, buf); err != nil {
 		return err
@@ -181,11 +271,19 @@ func (fd *FrameDescriptor) initR(f *Frame, src io.Reader) error {
 	fd.Flags = DescriptorFlags(descr)
 	if fd.Flags.Size() {
 		// Append the 8 missing bytes.
-		buf = buf[:3+8]
-		if _, err := io.ReadFull(src, buf[3:]); err != nil {
+		buf = buf[:len(buf)+8]
+		if _, err := io.ReadFull(src, buf[len(buf)-8:]); err != nil {
+			return err
+		}
+		fd.ContentSize = binary.LittleEndian.Uint64(buf[len(buf)-9:])
+	}
+	if fd.Flags.DictID() {
+		// Append the 4 missing bytes.
+		buf = buf[:len(buf)+4]
+		if _, err := io.ReadFull(src, buf[len(buf)-4:]); err != nil {
 			return err
 		}
-		fd.ContentSize = binary.LittleEndian.Uint64(buf[2:])
+		fd.DictID = binary.LittleEndian.Uint32(buf[len(buf)-5:])
 	}
 	fd.Checksum = buf[len(buf)-1] // the checksum is the last byte
 	buf = buf[:len(buf)-1]        // all descriptor fields except checksum
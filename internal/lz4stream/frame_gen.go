@@ -7,7 +7,8 @@ import "github.com/pierrec/lz4/v4/internal/lz4block"
 // DescriptorFlags is defined as follow:
 //   field              bits
 //   -----              ----
-//   _                  2
+//   DictID             1
+//   _                  1
 //   ContentChecksum    1
 //   Size               1
 //   BlockChecksum      1
@@ -19,6 +20,7 @@ import "github.com/pierrec/lz4/v4/internal/lz4block"
 type DescriptorFlags uint16
 
 // Getters.
+func (x DescriptorFlags) DictID() bool            { return x&1 != 0 }
 func (x DescriptorFlags) ContentChecksum() bool   { return x>>2&1 != 0 }
 func (x DescriptorFlags) Size() bool              { return x>>3&1 != 0 }
 func (x DescriptorFlags) BlockChecksum() bool     { return x>>4&1 != 0 }
@@ -29,6 +31,15 @@ func (x DescriptorFlags) BlockSizeIndex() lz4block.BlockSizeIndex {
 }
 
 // Setters.
+func (x *DescriptorFlags) DictIDSet(v bool) *DescriptorFlags {
+	const b = 1
+	if v {
+		*x = *x&^b | b
+	} else {
+		*x &^= b
+	}
+	return x
+}
 func (x *DescriptorFlags) ContentChecksumSet(v bool) *DescriptorFlags {
 	const b = 1 << 2
 	if v {
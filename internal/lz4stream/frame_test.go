@@ -15,11 +15,14 @@ func TestFrameDescriptor(t *testing.T) {
 		bsum, csize, csum bool
 		size              uint64
 		bsize             uint32
+		dictID            uint32
 	}{
-		{"\x64\x40\xa7", false, false, true, 0, lz4block.Block64Kb},
-		{"\x64\x50\x08", false, false, true, 0, lz4block.Block256Kb},
-		{"\x64\x60\x85", false, false, true, 0, lz4block.Block1Mb},
-		{"\x64\x70\xb9", false, false, true, 0, lz4block.Block4Mb},
+		{"\x64\x40\xa7", false, false, true, 0, lz4block.Block64Kb, 0},
+		{"\x64\x50\x08", false, false, true, 0, lz4block.Block256Kb, 0},
+		{"\x64\x60\x85", false, false, true, 0, lz4block.Block1Mb, 0},
+		{"\x64\x70\xb9", false, false, true, 0, lz4block.Block4Mb, 0},
+		{"\x65\x40\x78\x56\x34\x12\x3f", false, false, true, 0, lz4block.Block64Kb, 0x12345678},
+		{"\x6d\x70\xe8\x03\x00\x00\x00\x00\x00\x00\x78\x56\x34\x12\x65", false, true, true, 1000, lz4block.Block4Mb, 0x12345678},
 	} {
 		s := tc.flags
 		label := fmt.Sprintf("%02x %02x %02x", s[0], s[1], s[2])
@@ -46,6 +49,12 @@ func TestFrameDescriptor(t *testing.T) {
 			if got, want := fd.Flags.BlockSizeIndex(), lz4block.Index(tc.bsize); got != want {
 				t.Fatalf("got %v; want %v\n", got, want)
 			}
+			if got, want := fd.Flags.DictID(), tc.dictID != 0; got != want {
+				t.Fatalf("got %v; want %v\n", got, want)
+			}
+			if got, want := fd.DictID, tc.dictID; got != want {
+				t.Fatalf("got %v; want %v\n", got, want)
+			}
 
 			buf := new(bytes.Buffer)
 			fd.initW()
@@ -90,7 +99,7 @@ func TestFrameDataBlock(t *testing.T) {
 			f.Descriptor.Flags.BlockSizeIndexSet(lz4block.Index(size))
 
 			block := NewFrameDataBlock(f)
-			block.Compress(f, []byte(data), lz4block.Fast)
+			block.Compress(f, []byte(data), nil, lz4block.Params{Level: lz4block.Fast})
 			if err := block.Write(f, zbuf); err != nil {
 				t.Fatal(err)
 			}
@@ -9,6 +9,8 @@
 package lz4
 
 import (
+	"runtime"
+
 	"github.com/pierrec/lz4/v4/internal/lz4block"
 	"github.com/pierrec/lz4/v4/internal/lz4errors"
 )
@@ -17,6 +19,9 @@ func _() {
 	// Safety checks for duplicated elements.
 	var x [1]struct{}
 	_ = x[lz4block.CompressionLevel(Fast)-lz4block.Fast]
+	_ = x[lz4block.CompressionLevel(Level10)-lz4block.Level10]
+	_ = x[lz4block.CompressionLevel(Level11)-lz4block.Level11]
+	_ = x[lz4block.CompressionLevel(Level12)-lz4block.Level12]
 	_ = x[Block64Kb-BlockSize(lz4block.Block64Kb)]
 	_ = x[Block256Kb-BlockSize(lz4block.Block256Kb)]
 	_ = x[Block1Mb-BlockSize(lz4block.Block1Mb)]
@@ -28,6 +33,17 @@ func CompressBlockBound(n int) int {
 	return lz4block.CompressBlockBound(n)
 }
 
+// EstimateRatio returns a cheap estimate of the ratio of the compressed size of sample
+// to its size, when compressed at the Fast level.
+//
+// Only a fixed amount of sample is looked at, so the cost does not depend on its size.
+// Compressible data may be given a higher ratio than it actually has, but
+// incompressible data yields a ratio close to or above 1, so that it can be
+// stored as is instead of being compressed.
+func EstimateRatio(sample []byte) float64 {
+	return lz4block.EstimateRatio(sample)
+}
+
 // UncompressBlock uncompresses the source buffer into the destination one,
 // and returns the uncompressed size.
 //
@@ -48,13 +64,168 @@ func UncompressBlockWithDict(src, dst, dict []byte) (int, error) {
 	return lz4block.UncompressBlock(src, dst, dict)
 }
 
+// UncompressBlockPartial uncompresses the beginning of the source buffer into the
+// destination one, using an optional dictionary, and returns the uncompressed size.
+//
+// Decoding stops once targetSize bytes have been produced, so only the part of the block
+// needed to produce them is read. Fewer bytes are returned if the block is shorter.
+// targetSize is capped to the size of the destination buffer.
+//
+// An error is returned if the part of the source data being read is invalid.
+func UncompressBlockPartial(src, dst, dict []byte, targetSize int) (int, error) {
+	return lz4block.UncompressBlockPartial(src, dst, dict, targetSize)
+}
+
+// UncompressBlockSized uncompresses the block at the start of the source buffer into
+// the destination one, using an optional dictionary. The uncompressed size of the block
+// must be len(dst), the block ending when the destination buffer is full.
+// It returns the number of bytes written to dst and read from src, so that blocks
+// stored back to back can be uncompressed without knowing their compressed sizes.
+//
+// An error is returned if the block is invalid or does not uncompress to len(dst) bytes.
+func UncompressBlockSized(src, dst, dict []byte) (written, consumed int, err error) {
+	return lz4block.UncompressBlockSized(src, dst, dict)
+}
+
+// UncompressedBlockSize validates the source buffer and returns its uncompressed size,
+// without uncompressing it.
+//
+// An error is returned if the source data is invalid.
+func UncompressedBlockSize(src []byte) (int, error) {
+	return lz4block.UncompressedSize(src, 0)
+}
+
+// DiagnoseBlock reports why the source buffer cannot be uncompressed into dstLen bytes,
+// with matches referencing up to dictSize bytes of dictionary.
+// The uncompression functions only return the kind of error, so that failing is cheap:
+// DiagnoseBlock returns a BlockError with the offsets of the failing sequence,
+// or nil if the source buffer is valid.
+func DiagnoseBlock(src []byte, dstLen, dictSize int) error {
+	return lz4block.DiagnoseBlock(src, dstLen, dictSize)
+}
+
+// AppendUncompressedBlock uncompresses the source buffer, appends it to dst
+// and returns the extended buffer. dst is grown as needed.
+//
+// An error is returned if the source data is invalid, in which case dst is returned
+// with its original length.
+func AppendUncompressedBlock(dst, src []byte) ([]byte, error) {
+	return lz4block.AppendUncompressed(dst, src, nil)
+}
+
+// UncompressBlockInPlace uncompresses the source buffer held at buf[compressedOffset:]
+// into the beginning of buf, and returns the uncompressed size.
+// This avoids allocating a separate buffer for the compressed data.
+//
+// buf must hold the uncompressed data followed by at least
+// UncompressBlockInPlaceMargin(len(buf)-compressedOffset) bytes,
+// for the output to never overwrite compressed data that has not been read yet.
+//
+// An error is returned if the source data is invalid or buf is too small,
+// in which case the content of buf is undefined.
+func UncompressBlockInPlace(buf []byte, compressedOffset int) (int, error) {
+	return lz4block.UncompressInPlace(buf, compressedOffset)
+}
+
+// UncompressBlockInPlaceMargin returns the number of bytes required after the
+// uncompressed data by UncompressBlockInPlace, for a compressed block of the given size.
+//
+// A buffer of uncompressedSize+UncompressBlockInPlaceMargin(compressedSize) bytes
+// is large enough, with the compressed block copied at its end.
+func UncompressBlockInPlaceMargin(compressedSize int) int {
+	return lz4block.InPlaceMargin(compressedSize)
+}
+
+// CompressBlocks compresses every source buffer src[i] into the destination dst[i]
+// and sets dst[i] to the compressed data. The blocks are compressed independently
+// by up to runtime.GOMAXPROCS(0) goroutines, each one reusing its compressor:
+// a Compressor for the Fast level and a CompressorHC otherwise.
+// The Store level encodes the blocks as literals only.
+//
+// dst must have at least as many buffers as src. As with Compressor.CompressBlock,
+// dst[i] is set to an empty slice if src[i] is incompressible and dst[i] is shorter
+// than CompressBlockBound(len(src[i])).
+//
+// If a block cannot be compressed, the error of the first such block is returned
+// and the content of dst is undefined.
+func CompressBlocks(dst, src [][]byte, level CompressionLevel) error {
+	var p lz4block.Params
+	setLevel(&p, level)
+	return p.CompressBlocks(dst, src, runtime.GOMAXPROCS(0))
+}
+
+// UncompressBlocks uncompresses every source buffer src[i] into the destination dst[i]
+// and sets dst[i] to the uncompressed data, using up to runtime.GOMAXPROCS(0) goroutines.
+//
+// dst must have at least as many buffers as src, each one sized appropriately.
+//
+// If a block cannot be uncompressed, the error of the first such block is returned
+// and the content of dst is undefined.
+func UncompressBlocks(dst, src [][]byte) error {
+	return lz4block.UncompressBlocks(dst, src, runtime.GOMAXPROCS(0))
+}
+
+// A Sequence is the unit of the LZ4 block format: a run of literals followed by
+// a match of MatchLen bytes, starting Offset bytes back in the uncompressed data.
+// The last sequence of a block only has literals.
+type Sequence struct {
+	Literals []byte // the literals, which are part of the block
+	Offset   int    // match offset, 0 for the last sequence of a block
+	MatchLen int    // match length, 0 for the last sequence of a block
+}
+
+// A SequenceScanner iterates over the sequences of a compressed block
+// without uncompressing it.
+//
+// Scanning stops at the end of the block or at the first error. The block is
+// checked as when uncompressing it, so that a block scanned without error
+// can be uncompressed successfully.
+type SequenceScanner struct {
+	s *lz4block.SequenceScanner
+}
+
+// NewSequenceScanner returns a SequenceScanner for the block src.
+// Matches may reference up to dictSize bytes before the block,
+// as when uncompressing it with UncompressBlockWithDict.
+func NewSequenceScanner(src []byte, dictSize int) *SequenceScanner {
+	return &SequenceScanner{lz4block.NewSequenceScanner(src, dictSize)}
+}
+
+// Scan advances the scanner to the next sequence, which is then available through
+// the Sequence method. It returns false when the scan stops, either by reaching
+// the end of the block or on error.
+func (s *SequenceScanner) Scan() bool { return s.s.Scan() }
+
+// Sequence returns the sequence found by the last call to Scan.
+func (s *SequenceScanner) Sequence() Sequence { return Sequence(s.s.Sequence()) }
+
+// Err returns the first error encountered by the scanner, if any.
+func (s *SequenceScanner) Err() error { return s.s.Err() }
+
+// UncompressedSize returns the uncompressed size of the sequences scanned so far.
+func (s *SequenceScanner) UncompressedSize() int { return s.s.UncompressedLen() }
+
 // A Compressor compresses data into the LZ4 block format.
 // It uses a fast compression algorithm.
 //
 // A Compressor is not safe for concurrent use by multiple goroutines.
 //
 // Use a Writer to compress into the LZ4 stream format.
-type Compressor struct{ c lz4block.Compressor }
+type Compressor struct {
+	// Acceleration trades compression ratio for speed: the higher the faster.
+	// Values <= 1 mean the default acceleration.
+	Acceleration int
+	// HashLog is the base 2 logarithm of the number of entries of the hash table
+	// used to find matches. Small tables are faster on small inputs while large ones
+	// improve the compression ratio on large inputs.
+	// Values <= 0 mean the default of 16, others are capped to [8, 20].
+	HashLog int
+	// MaxOffset is the largest distance back that matches may reference,
+	// for decoders keeping a window of uncompressed data smaller than 64Kb.
+	// Values <= 0 or above 65535 mean the maximum of 65535 allowed by the LZ4 format.
+	MaxOffset int
+	c         lz4block.Compressor
+}
 
 // CompressBlock compresses the source buffer src into the destination dst.
 //
@@ -68,9 +239,45 @@ type Compressor struct{ c lz4block.Compressor }
 // return value (0, nil) means the data is likely incompressible and a buffer
 // of length CompressBlockBound(len(src)) should be passed in.
 func (c *Compressor) CompressBlock(src, dst []byte) (int, error) {
+	c.c.Acceleration = c.Acceleration
+	c.c.HashLog = c.HashLog
+	c.c.MaxOffset = c.MaxOffset
 	return c.c.CompressBlock(src, dst)
 }
 
+// CompressBlockDestSize compresses the longest prefix of src that fits into dst,
+// and returns the number of bytes read from src and written to dst.
+//
+// Unless all of src fits, dst is filled up to a few bytes.
+func (c *Compressor) CompressBlockDestSize(src, dst []byte) (read, written int) {
+	c.c.Acceleration = c.Acceleration
+	c.c.HashLog = c.HashLog
+	c.c.MaxOffset = c.MaxOffset
+	return c.c.CompressBlockDestSize(src, dst)
+}
+
+// CompressBlockWithDict is like CompressBlock but the compressed data may
+// reference the last 64Kb of dict, which must then be supplied to
+// UncompressBlockWithDict to uncompress it.
+//
+// The dictionary is indexed on every call. Use CompressBlockWithDictionary
+// to compress many blocks with the same dictionary.
+func (c *Compressor) CompressBlockWithDict(src, dst, dict []byte) (int, error) {
+	c.c.Acceleration = c.Acceleration
+	c.c.HashLog = c.HashLog
+	c.c.MaxOffset = c.MaxOffset
+	return c.c.CompressBlockWithDict(src, dst, dict)
+}
+
+// CompressBlockWithDictionary is like CompressBlockWithDict but uses a
+// prepared dictionary.
+func (c *Compressor) CompressBlockWithDictionary(src, dst []byte, dict *Dictionary) (int, error) {
+	c.c.Acceleration = c.Acceleration
+	c.c.HashLog = c.HashLog
+	c.c.MaxOffset = c.MaxOffset
+	return c.c.CompressBlockWithPreparedDict(src, dst, dict.d)
+}
+
 // CompressBlock compresses the source buffer into the destination one.
 // This is the fast version of LZ4 compression and also the default one.
 //
@@ -103,8 +310,16 @@ func CompressBlock(src, dst []byte, _ []int) (int, error) {
 type CompressorHC struct {
 	// Level is the maximum search depth for compression.
 	// Values <= 0 mean no maximum.
+	// Level10 and above use optimal parsing instead.
+	// Store encodes the blocks as literals only.
 	Level CompressionLevel
-	c     lz4block.CompressorHC
+	// MaxOffset is the largest match offset, as for Compressor.
+	MaxOffset int
+	// FavorDecSpeed trades a slightly lower compression ratio for faster
+	// decompression, as with the favorDecSpeed flag of the reference implementation.
+	// It only applies to Level10 and above.
+	FavorDecSpeed bool
+	c             lz4block.CompressorHC
 }
 
 // CompressBlock compresses the source buffer src into the destination dst.
@@ -119,9 +334,157 @@ type CompressorHC struct {
 // return value (0, nil) means the data is likely incompressible and a buffer
 // of length CompressBlockBound(len(src)) should be passed in.
 func (c *CompressorHC) CompressBlock(src, dst []byte) (int, error) {
+	c.c.MaxOffset = c.MaxOffset
+	c.c.FavorDecSpeed = c.FavorDecSpeed
+	return c.c.CompressBlock(src, dst, lz4block.CompressionLevel(c.Level))
+}
+
+// CompressBlockWithDict is like CompressBlock but the compressed data may
+// reference the last 64Kb of dict, which must then be supplied to
+// UncompressBlockWithDict to uncompress it.
+//
+// The dictionary is indexed on every call. Use CompressBlockWithDictionary
+// to compress many blocks with the same dictionary.
+func (c *CompressorHC) CompressBlockWithDict(src, dst, dict []byte) (int, error) {
+	c.c.MaxOffset = c.MaxOffset
+	c.c.FavorDecSpeed = c.FavorDecSpeed
+	return c.c.CompressBlockWithDict(src, dst, dict, lz4block.CompressionLevel(c.Level))
+}
+
+// CompressBlockWithDictionary is like CompressBlockWithDict but uses a
+// prepared dictionary.
+func (c *CompressorHC) CompressBlockWithDictionary(src, dst []byte, dict *Dictionary) (int, error) {
+	c.c.MaxOffset = c.MaxOffset
+	c.c.FavorDecSpeed = c.FavorDecSpeed
+	return c.c.CompressBlockWithPreparedDict(src, dst, dict.d, lz4block.CompressionLevel(c.Level))
+}
+
+// A Dictionary is a dictionary prepared for block compression.
+// Its content is indexed once for each kind of compressor using it,
+// instead of on every call as with CompressBlockWithDict.
+//
+// A Dictionary is safe for concurrent use by multiple goroutines.
+type Dictionary struct{ d *lz4block.Dict }
+
+// NewDictionary returns a Dictionary for the last 64Kb of dict.
+// The dictionary data is copied.
+func NewDictionary(dict []byte) *Dictionary {
+	return &Dictionary{lz4block.NewDict(dict)}
+}
+
+// Bytes returns the dictionary data, to be supplied to UncompressBlockWithDict.
+// It must not be modified.
+func (d *Dictionary) Bytes() []byte { return d.d.Bytes() }
+
+// TrainDictionary returns a dictionary of at most size bytes, capped to 64Kb,
+// made of the segments of samples that occur the most across them.
+// It is meant for compressing many small inputs similar to the samples,
+// with CompressBlockWithDict or NewDictionary, and uncompressing them with
+// UncompressBlockWithDict.
+//
+// If the samples are no larger than size, the dictionary is their concatenation.
+func TrainDictionary(samples [][]byte, size int) []byte {
+	return lz4block.Train(samples, size)
+}
+
+// A StreamCompressor compresses data into a sequence of dependent LZ4 blocks:
+// each block may reference the previous 64Kb of data compressed by the same
+// StreamCompressor, which improves the compression ratio of small blocks.
+//
+// The blocks must be uncompressed in order, each one with the previous 64Kb
+// of uncompressed data as dictionary, for instance with a StreamDecompressor.
+// Blocks reported as incompressible are still part of that history, so
+// they must be stored as is and supplied to the decompressor.
+//
+// If CompressBlock returns an error, the StreamCompressor must be Reset
+// before being used again.
+//
+// A StreamCompressor is not safe for concurrent use by multiple goroutines.
+type StreamCompressor struct {
+	// Acceleration trades compression ratio for speed: the higher the faster.
+	// Values <= 1 mean the default acceleration.
+	Acceleration int
+	// HashLog is the size of the hash table, as for Compressor.
+	HashLog int
+	// MaxOffset is the largest match offset, as for Compressor.
+	MaxOffset int
+	c         lz4block.StreamCompressor
+}
+
+// CompressBlock compresses the source buffer src into the destination dst,
+// using the previously compressed data as dictionary.
+//
+// The return values are the same as for Compressor.CompressBlock.
+func (c *StreamCompressor) CompressBlock(src, dst []byte) (int, error) {
+	c.c.Acceleration = c.Acceleration
+	c.c.HashLog = c.HashLog
+	c.c.MaxOffset = c.MaxOffset
+	return c.c.CompressBlock(src, dst)
+}
+
+// Reset discards the history of c so that the next block is compressed independently.
+func (c *StreamCompressor) Reset() { c.c.Reset() }
+
+// A StreamCompressorHC is the high compression version of StreamCompressor.
+//
+// A StreamCompressorHC is not safe for concurrent use by multiple goroutines.
+type StreamCompressorHC struct {
+	// Level is the maximum search depth for compression.
+	// Values <= 0 mean no maximum.
+	// Level10 and above use optimal parsing instead.
+	Level CompressionLevel
+	// MaxOffset is the largest match offset, as for Compressor.
+	MaxOffset int
+	// FavorDecSpeed is as for CompressorHC.
+	FavorDecSpeed bool
+	c             lz4block.StreamCompressorHC
+}
+
+// CompressBlock compresses the source buffer src into the destination dst,
+// using the previously compressed data as dictionary.
+//
+// The return values are the same as for CompressorHC.CompressBlock.
+func (c *StreamCompressorHC) CompressBlock(src, dst []byte) (int, error) {
+	c.c.MaxOffset = c.MaxOffset
+	c.c.FavorDecSpeed = c.FavorDecSpeed
 	return c.c.CompressBlock(src, dst, lz4block.CompressionLevel(c.Level))
 }
 
+// Reset discards the history of c so that the next block is compressed independently.
+func (c *StreamCompressorHC) Reset() { c.c.Reset() }
+
+// A StreamDecompressor uncompresses a sequence of dependent LZ4 blocks,
+// such as the ones produced by a StreamCompressor. It uses the last 64Kb
+// of uncompressed data as dictionary for the next block.
+//
+// That data is referenced where it was uncompressed rather than copied, so it must
+// be left unchanged until the next block is uncompressed. Uncompressing the blocks
+// one after the other into the same buffer avoids copies entirely; otherwise the
+// part of the history still needed is copied when a block is uncompressed elsewhere.
+//
+// A StreamDecompressor is not safe for concurrent use by multiple goroutines.
+type StreamDecompressor struct{ d lz4block.StreamDecompressor }
+
+// UncompressBlock uncompresses the source buffer into the destination one,
+// using the previously uncompressed data as dictionary, and returns the
+// uncompressed size.
+//
+// The destination buffer must be sized appropriately.
+//
+// An error is returned if the source data is invalid or the destination buffer is too small,
+// in which case the history is left unchanged.
+func (d *StreamDecompressor) UncompressBlock(src, dst []byte) (int, error) {
+	return d.d.UncompressBlock(src, dst)
+}
+
+// AddUncompressed adds data to the history of d.
+// It must be called for blocks that were stored uncompressed.
+// As with uncompressed blocks, data must be left unchanged until the next block.
+func (d *StreamDecompressor) AddUncompressed(data []byte) { d.d.AddUncompressed(data) }
+
+// Reset discards the history of d.
+func (d *StreamDecompressor) Reset() { d.d.Reset() }
+
 // CompressBlockHC is equivalent to CompressorHC.CompressBlock.
 // The final two arguments are ignored and should be set to nil.
 //
@@ -130,10 +493,27 @@ func CompressBlockHC(src, dst []byte, depth CompressionLevel, _, _ []int) (int,
 	return lz4block.CompressBlockHC(src, dst, lz4block.CompressionLevel(depth))
 }
 
+// A BlockError is returned by DiagnoseBlock, UncompressedBlockSize, AppendUncompressedBlock
+// and SequenceScanner, with the offsets in the source and destination buffers of the
+// sequence that could not be processed. The other uncompression functions return its Err field.
+// Its Err field is one of ErrShortDestination, ErrCorruptBlock or ErrOffsetOutOfRange.
+type BlockError = lz4errors.BlockError
+
+// BlockErrorKind is the type of the Err field of a BlockError.
+type BlockErrorKind = lz4errors.BlockErrorKind
+
 const (
 	// ErrInvalidSourceShortBuffer is returned by UncompressBlock or CompressBLock when a compressed
 	// block is corrupted or the destination buffer is not large enough for the uncompressed data.
+	// The more specific ErrShortDestination, ErrCorruptBlock and ErrOffsetOutOfRange match it with errors.Is.
 	ErrInvalidSourceShortBuffer = lz4errors.ErrInvalidSourceShortBuffer
+	// ErrShortDestination is returned when the destination buffer is not large enough for an uncompressed block.
+	ErrShortDestination = lz4errors.ErrShortDestination
+	// ErrCorruptBlock is returned when a compressed block is truncated or invalid.
+	ErrCorruptBlock = lz4errors.ErrCorruptBlock
+	// ErrOffsetOutOfRange is returned when a match of a compressed block references data
+	// before the start of the block and its dictionary.
+	ErrOffsetOutOfRange = lz4errors.ErrOffsetOutOfRange
 	// ErrInvalidFrame is returned when reading an invalid LZ4 archive.
 	ErrInvalidFrame = lz4errors.ErrInvalidFrame
 	// ErrInternalUnhandledState is an internal error.
@@ -152,6 +532,18 @@ const (
 	ErrOptionInvalidBlockSize = lz4errors.ErrOptionInvalidBlockSize
 	// ErrOptionNotApplicable is returned when trying to apply an option to an object not supporting it.
 	ErrOptionNotApplicable = lz4errors.ErrOptionNotApplicable
-	// ErrWriterNotClosed is returned when attempting to reset an unclosed writer.
+	// ErrOptionInvalidHashLog is returned when the supplied hash table size is invalid.
+	ErrOptionInvalidHashLog = lz4errors.ErrOptionInvalidHashLog
+	// ErrOptionInvalidMaxOffset is returned when the supplied maximum match offset is invalid.
+	ErrOptionInvalidMaxOffset = lz4errors.ErrOptionInvalidMaxOffset
+	// ErrWriterNotClosed is returned when attempting to reset an unclosed writer,
+	// or to write a skippable frame while an LZ4 frame is being written.
 	ErrWriterNotClosed = lz4errors.ErrWriterNotClosed
+	// ErrWriterClosed is returned when writing to a closed writer that has not been reset.
+	ErrWriterClosed = lz4errors.ErrWriterClosed
+	// ErrInvalidSkippableFrame is returned when a skippable frame magic nibble or payload size is out of range.
+	ErrInvalidSkippableFrame = lz4errors.ErrInvalidSkippableFrame
+	// ErrDictionaryNotFound is returned when reading a frame with a dictionary ID
+	// and no dictionary resolver, see DictionaryResolverOption.
+	ErrDictionaryNotFound = lz4errors.ErrDictionaryNotFound
 )
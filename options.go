@@ -2,6 +2,7 @@ package lz4
 
 import (
 	"fmt"
+	"io"
 	"reflect"
 	"runtime"
 
@@ -31,6 +32,8 @@ var (
 	DefaultChecksumOption  = ChecksumOption(true)
 	DefaultConcurrency     = ConcurrencyOption(1)
 	defaultOnBlockDone     = OnBlockDoneOption(nil)
+	defaultIndependence    = BlockIndependenceOption(true)
+	defaultConcatenated    = ConcatenatedFramesOption(true)
 )
 
 const (
@@ -87,6 +90,29 @@ func BlockChecksumOption(flag bool) Option {
 	}
 }
 
+// BlockIndependenceOption makes the blocks independent of each other (default=true).
+// Dependent blocks may reference the last 64Kb of the previous blocks, which improves
+// the compression ratio with small blocks.
+// With concurrency, each block is compressed with a copy of the 64Kb preceding it,
+// and the Reader uncompresses them sequentially.
+// It has no effect on legacy frames.
+func BlockIndependenceOption(flag bool) Option {
+	return func(a applier) error {
+		switch w := a.(type) {
+		case nil:
+			s := fmt.Sprintf("BlockIndependenceOption(%v)", flag)
+			return lz4errors.Error(s)
+		case *Writer:
+			w.frame.Descriptor.Flags.BlockIndependenceSet(flag)
+			return nil
+		case *CompressingReader:
+			w.frame.Descriptor.Flags.BlockIndependenceSet(flag)
+			return nil
+		}
+		return lz4errors.ErrOptionNotApplicable
+	}
+}
+
 // ChecksumOption enables/disables all blocks or content checksum (default=true).
 func ChecksumOption(flag bool) Option {
 	return func(a applier) error {
@@ -105,6 +131,57 @@ func ChecksumOption(flag bool) Option {
 	}
 }
 
+// DictionaryOption sets the dictionary that the blocks may reference, and its ID
+// recorded in the frame so that readers can find it (default=none).
+// The dictionary precedes the first block, or every block if they are independent,
+// and only its last 64Kb are used. A nil dict removes the dictionary.
+// It has no effect on legacy frames.
+func DictionaryOption(id uint32, dict []byte) Option {
+	return func(a applier) error {
+		switch w := a.(type) {
+		case nil:
+			s := fmt.Sprintf("DictionaryOption(%d, %d bytes)", id, len(dict))
+			return lz4errors.Error(s)
+		case *Writer:
+			w.frame.Descriptor.Flags.DictIDSet(dict != nil)
+			w.frame.Descriptor.DictID = id
+			w.dict = newDict(dict)
+			return nil
+		case *CompressingReader:
+			w.frame.Descriptor.Flags.DictIDSet(dict != nil)
+			w.frame.Descriptor.DictID = id
+			w.dict = newDict(dict)
+			return nil
+		}
+		return lz4errors.ErrOptionNotApplicable
+	}
+}
+
+// newDict returns the prepared dictionary for dict, or nil if there is none.
+func newDict(dict []byte) *lz4block.Dict {
+	if dict == nil {
+		return nil
+	}
+	return lz4block.NewDict(dict)
+}
+
+// DictionaryResolverOption sets the function returning the dictionary of the given ID
+// for the frames that specify one, as written with DictionaryOption.
+// Without a resolver, reading such frames fails with ErrDictionaryNotFound.
+func DictionaryResolverOption(resolve func(id uint32) ([]byte, error)) Option {
+	return func(a applier) error {
+		switch r := a.(type) {
+		case nil:
+			s := fmt.Sprintf("DictionaryResolverOption(%s)", reflect.TypeOf(resolve).String())
+			return lz4errors.Error(s)
+		case *Reader:
+			r.resolve = resolve
+			return nil
+		}
+		return lz4errors.ErrOptionNotApplicable
+	}
+}
+
 // SizeOption sets the size of the original uncompressed data (default=0). It is useful to know the size of the
 // whole uncompressed data stream.
 func SizeOption(size uint64) Option {
@@ -141,7 +218,7 @@ func ConcurrencyOption(n int) Option {
 			rw.num = n
 			return nil
 		case *Reader:
-			rw.num = n
+			rw.num, rw.conc = n, n
 			return nil
 		}
 		return lz4errors.ErrOptionNotApplicable
@@ -162,8 +239,25 @@ const (
 	Level7
 	Level8
 	Level9
+	// Level10 to Level12 use optimal parsing, which is much slower but gives the best compression ratio.
+	Level10
+	Level11
+	Level12
 )
 
+// Store does not compress the data: the Writer stores its blocks uncompressed,
+// at the speed of copying them, while CompressBlocks, CompressorHC and CompressBlockHC
+// encode them as literals only.
+const Store = CompressionLevel(lz4block.Store)
+
+// setLevel sets the compression level of p, the Store level being a flag of its own.
+func setLevel(p *lz4block.Params, level CompressionLevel) {
+	p.Level, p.Store = lz4block.CompressionLevel(level), level == Store
+	if p.Store {
+		p.Level = lz4block.Fast
+	}
+}
+
 // CompressionLevelOption defines the compression level (default=Fast).
 func CompressionLevelOption(level CompressionLevel) Option {
 	return func(a applier) error {
@@ -173,19 +267,129 @@ func CompressionLevelOption(level CompressionLevel) Option {
 			return lz4errors.Error(s)
 		case *Writer:
 			switch level {
-			case Fast, Level1, Level2, Level3, Level4, Level5, Level6, Level7, Level8, Level9:
+			case Fast, Store, Level1, Level2, Level3, Level4, Level5, Level6, Level7, Level8, Level9, Level10, Level11, Level12:
 			default:
 				return fmt.Errorf("%w: %d", lz4errors.ErrOptionInvalidCompressionLevel, level)
 			}
-			w.level = lz4block.CompressionLevel(level)
+			setLevel(&w.params, level)
 			return nil
 		case *CompressingReader:
 			switch level {
-			case Fast, Level1, Level2, Level3, Level4, Level5, Level6, Level7, Level8, Level9:
+			case Fast, Store, Level1, Level2, Level3, Level4, Level5, Level6, Level7, Level8, Level9, Level10, Level11, Level12:
 			default:
 				return fmt.Errorf("%w: %d", lz4errors.ErrOptionInvalidCompressionLevel, level)
 			}
-			w.level = lz4block.CompressionLevel(level)
+			setLevel(&w.params, level)
+			return nil
+		}
+		return lz4errors.ErrOptionNotApplicable
+	}
+}
+
+// AccelerationOption sets the acceleration of the Fast compression level (default=1).
+// The higher the acceleration, the faster the compression but the lower the compression ratio.
+// Values < 1 mean the default acceleration.
+func AccelerationOption(n int) Option {
+	return func(a applier) error {
+		switch w := a.(type) {
+		case nil:
+			s := fmt.Sprintf("AccelerationOption(%d)", n)
+			return lz4errors.Error(s)
+		case *Writer:
+			w.params.Acceleration = n
+			return nil
+		case *CompressingReader:
+			w.params.Acceleration = n
+			return nil
+		}
+		return lz4errors.ErrOptionNotApplicable
+	}
+}
+
+// HashLogOption sets the base 2 logarithm of the hash table size of the Fast compression level (default=16).
+// Small tables are faster on small blocks while large ones improve the compression ratio on large blocks.
+// Valid values are in the range [8, 20].
+func HashLogOption(n int) Option {
+	return func(a applier) error {
+		switch w := a.(type) {
+		case nil:
+			s := fmt.Sprintf("HashLogOption(%d)", n)
+			return lz4errors.Error(s)
+		case *Writer:
+			if n < lz4block.MinHashLog || n > lz4block.MaxHashLog {
+				return fmt.Errorf("%w: %d", lz4errors.ErrOptionInvalidHashLog, n)
+			}
+			w.params.HashLog = n
+			return nil
+		case *CompressingReader:
+			if n < lz4block.MinHashLog || n > lz4block.MaxHashLog {
+				return fmt.Errorf("%w: %d", lz4errors.ErrOptionInvalidHashLog, n)
+			}
+			w.params.HashLog = n
+			return nil
+		}
+		return lz4errors.ErrOptionNotApplicable
+	}
+}
+
+// MaxOffsetOption sets the largest distance back that matches may reference (default=65535),
+// for decoders keeping a window of uncompressed data smaller than 64Kb.
+// The output remains valid LZ4 data. Valid values are in the range [1, 65535].
+func MaxOffsetOption(n int) Option {
+	return func(a applier) error {
+		switch w := a.(type) {
+		case nil:
+			s := fmt.Sprintf("MaxOffsetOption(%d)", n)
+			return lz4errors.Error(s)
+		case *Writer:
+			if n < 1 || n > lz4block.MaxOffset {
+				return fmt.Errorf("%w: %d", lz4errors.ErrOptionInvalidMaxOffset, n)
+			}
+			w.params.MaxOffset = n
+			return nil
+		case *CompressingReader:
+			if n < 1 || n > lz4block.MaxOffset {
+				return fmt.Errorf("%w: %d", lz4errors.ErrOptionInvalidMaxOffset, n)
+			}
+			w.params.MaxOffset = n
+			return nil
+		}
+		return lz4errors.ErrOptionNotApplicable
+	}
+}
+
+// FavorDecSpeedOption makes the optimal parsing compression levels, Level10 and above,
+// favor decompression speed over compression ratio (default=false).
+// It has no effect on the other levels.
+func FavorDecSpeedOption(flag bool) Option {
+	return func(a applier) error {
+		switch w := a.(type) {
+		case nil:
+			s := fmt.Sprintf("FavorDecSpeedOption(%v)", flag)
+			return lz4errors.Error(s)
+		case *Writer:
+			w.params.FavorDecSpeed = flag
+			return nil
+		case *CompressingReader:
+			w.params.FavorDecSpeed = flag
+			return nil
+		}
+		return lz4errors.ErrOptionNotApplicable
+	}
+}
+
+// StoreIncompressibleOption makes the Writer store blocks uncompressed without trying
+// to compress them when they are incompressible (default=false).
+// Every block is probed with a cheap estimate of its compression ratio, see EstimateRatio.
+// It has no effect on legacy frames, which cannot store uncompressed blocks.
+func StoreIncompressibleOption(flag bool) Option {
+	return func(a applier) error {
+		switch w := a.(type) {
+		case nil:
+			s := fmt.Sprintf("StoreIncompressibleOption(%v)", flag)
+			return lz4errors.Error(s)
+		case *Writer:
+			w.store = flag
 			return nil
 		}
 		return lz4errors.ErrOptionNotApplicable
@@ -219,6 +423,77 @@ func OnBlockDoneOption(handler func(size int)) Option {
 	}
 }
 
+// OnSkippableFrameOption is triggered by a Reader for every skippable frame it encounters,
+// with the magic nibble (0-15) of the frame and its payload, which is only valid until the handler returns.
+// The part of the payload that is not read by the handler is discarded.
+// Skippable frames are discarded if no handler is set (default).
+func OnSkippableFrameOption(handler func(nibble uint8, payload io.Reader) error) Option {
+	return func(a applier) error {
+		switch r := a.(type) {
+		case nil:
+			s := fmt.Sprintf("OnSkippableFrameOption(%s)", reflect.TypeOf(handler).String())
+			return lz4errors.Error(s)
+		case *Reader:
+			r.onSkip = handler
+			return nil
+		}
+		return lz4errors.ErrOptionNotApplicable
+	}
+}
+
+// OnFrameOption is triggered by a Reader when it starts reading a frame, with the information
+// from the frame descriptor.
+func OnFrameOption(handler func(info FrameInfo)) Option {
+	return func(a applier) error {
+		switch r := a.(type) {
+		case nil:
+			s := fmt.Sprintf("OnFrameOption(%s)", reflect.TypeOf(handler).String())
+			return lz4errors.Error(s)
+		case *Reader:
+			r.onFrame = handler
+			return nil
+		}
+		return lz4errors.ErrOptionNotApplicable
+	}
+}
+
+// OnBlockOption is triggered by a Reader for every block it reads, before uncompressing it,
+// with the block data as found in the frame, whether the block is stored uncompressed, and
+// the data preceding it that its matches may reference, for instance to scan it with a
+// SequenceScanner. The slices are only valid until the handler returns.
+// An error returned by the handler is returned by the Reader.
+// The blocks are then uncompressed sequentially.
+func OnBlockOption(handler func(block []byte, stored bool, dict []byte) error) Option {
+	return func(a applier) error {
+		switch r := a.(type) {
+		case nil:
+			s := fmt.Sprintf("OnBlockOption(%s)", reflect.TypeOf(handler).String())
+			return lz4errors.Error(s)
+		case *Reader:
+			r.onBlock = handler
+			return nil
+		}
+		return lz4errors.ErrOptionNotApplicable
+	}
+}
+
+// ConcatenatedFramesOption makes a Reader read the frames following the first one as a single stream,
+// like the lz4 command line tool does, including skippable frames and zero bytes padding the end
+// of the stream (default=true). Otherwise, the Reader stops at the end of the first frame.
+func ConcatenatedFramesOption(flag bool) Option {
+	return func(a applier) error {
+		switch r := a.(type) {
+		case nil:
+			s := fmt.Sprintf("ConcatenatedFramesOption(%v)", flag)
+			return lz4errors.Error(s)
+		case *Reader:
+			r.concat = flag
+			return nil
+		}
+		return lz4errors.ErrOptionNotApplicable
+	}
+}
+
 // LegacyOption provides support for writing LZ4 frames in the legacy format.
 //
 // See https://github.com/lz4/lz4/blob/dev/doc/lz4_Frame_format.md#legacy-frame.
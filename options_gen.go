@@ -49,19 +49,27 @@ func _() {
 	_ = x[Level7-32768]
 	_ = x[Level8-65536]
 	_ = x[Level9-131072]
+	_ = x[Level10-262144]
+	_ = x[Level11-524288]
+	_ = x[Level12-1048576]
+	_ = x[Store-4294967295]
 }
 
 const (
-	_CompressionLevel_name_0 = "Fast"
-	_CompressionLevel_name_1 = "Level1"
-	_CompressionLevel_name_2 = "Level2"
-	_CompressionLevel_name_3 = "Level3"
-	_CompressionLevel_name_4 = "Level4"
-	_CompressionLevel_name_5 = "Level5"
-	_CompressionLevel_name_6 = "Level6"
-	_CompressionLevel_name_7 = "Level7"
-	_CompressionLevel_name_8 = "Level8"
-	_CompressionLevel_name_9 = "Level9"
+	_CompressionLevel_name_0  = "Fast"
+	_CompressionLevel_name_1  = "Level1"
+	_CompressionLevel_name_2  = "Level2"
+	_CompressionLevel_name_3  = "Level3"
+	_CompressionLevel_name_4  = "Level4"
+	_CompressionLevel_name_5  = "Level5"
+	_CompressionLevel_name_6  = "Level6"
+	_CompressionLevel_name_7  = "Level7"
+	_CompressionLevel_name_8  = "Level8"
+	_CompressionLevel_name_9  = "Level9"
+	_CompressionLevel_name_10 = "Level10"
+	_CompressionLevel_name_11 = "Level11"
+	_CompressionLevel_name_12 = "Level12"
+	_CompressionLevel_name_13 = "Store"
 )
 
 func (i CompressionLevel) String() string {
@@ -86,6 +94,14 @@ func (i CompressionLevel) String() string {
 		return _CompressionLevel_name_8
 	case i == 131072:
 		return _CompressionLevel_name_9
+	case i == 262144:
+		return _CompressionLevel_name_10
+	case i == 524288:
+		return _CompressionLevel_name_11
+	case i == 1048576:
+		return _CompressionLevel_name_12
+	case i == 4294967295:
+		return _CompressionLevel_name_13
 	default:
 		return "CompressionLevel(" + strconv.FormatInt(int64(i), 10) + ")"
 	}
@@ -2,6 +2,7 @@ package lz4
 
 import (
 	"bytes"
+	"fmt"
 	"io"
 
 	"github.com/pierrec/lz4/v4/internal/lz4block"
@@ -25,7 +26,7 @@ func NewReader(r io.Reader) *Reader {
 func newReader(r io.Reader, legacy bool) *Reader {
 	zr := &Reader{frame: lz4stream.NewFrame()}
 	zr.state.init(readerStates)
-	_ = zr.Apply(DefaultConcurrency, defaultOnBlockDone)
+	_ = zr.Apply(DefaultConcurrency, defaultOnBlockDone, defaultConcatenated)
 	zr.Reset(r)
 	return zr
 }
@@ -34,14 +35,31 @@ func newReader(r io.Reader, legacy bool) *Reader {
 type Reader struct {
 	state   _State
 	src     io.Reader        // source reader
-	num     int              // concurrency level
+	num     int              // concurrency level of the frame being read
+	conc    int              // concurrency level set by ConcurrencyOption
 	frame   *lz4stream.Frame // frame being read
 	data    []byte           // block buffer allocated in non concurrent mode
 	reads   chan []byte      // pending data
 	idx     int              // size of pending data
 	handler func(int)
 	cum     uint32
-	dict    []byte
+	hist    lz4block.StreamDecompressor                        // history of dependent blocks
+	resolve func(id uint32) ([]byte, error)                    // dictionary resolver
+	onSkip  func(nibble uint8, payload io.Reader) error        // skippable frames handler
+	onFrame func(FrameInfo)                                    // new frames handler
+	onBlock func(block []byte, stored bool, dict []byte) error // blocks handler
+	concat  bool                                               // read the frames following the first one
+}
+
+// FrameInfo describes an LZ4 frame from its descriptor.
+type FrameInfo struct {
+	Legacy            bool      // legacy frame, the other fields are not set except BlockSize
+	BlockSize         BlockSize // maximum size of the uncompressed blocks
+	BlockIndependence bool
+	BlockChecksum     bool
+	ContentChecksum   bool
+	ContentSize       uint64 // size of the uncompressed data, 0 if not set
+	DictID            uint32 // dictionary ID, 0 if not set
 }
 
 func (*Reader) private() {}
@@ -63,7 +81,7 @@ func (r *Reader) Apply(options ...Option) (err error) {
 	return
 }
 
-// Size returns the size of the underlying uncompressed data, if set in the stream.
+// Size returns the size of the underlying uncompressed data of the frame being read, if set in the stream.
 func (r *Reader) Size() int {
 	switch r.state.state {
 	case readState, closedState:
@@ -79,16 +97,70 @@ func (r *Reader) isNotConcurrent() bool {
 }
 
 func (r *Reader) init() error {
-	err := r.frame.ParseHeaders(r.src)
+	err := r.frame.ParseHeaders(r.src, r.onSkip)
 	if err != nil {
 		return err
 	}
-	if !r.frame.Descriptor.Flags.BlockIndependence() {
-		// We can't decompress dependent blocks concurrently.
+	return r.initFrame()
+}
+
+// nextFrame sets up the reading of the frame following the current one.
+// It returns io.EOF if there is none or if concatenated frames are not read.
+func (r *Reader) nextFrame() error {
+	if !r.concat {
+		return io.EOF
+	}
+	err := r.frame.ParseNextHeaders(r.src, r.num, r.onSkip)
+	if err != nil {
+		return err
+	}
+	lz4block.Put(r.data)
+	return r.initFrame()
+}
+
+func (r *Reader) frameInfo() FrameInfo {
+	fd := r.frame.Descriptor
+	info := FrameInfo{
+		Legacy:    r.frame.IsLegacy(),
+		BlockSize: BlockSize(fd.Flags.BlockSizeIndex().Size()),
+	}
+	if info.Legacy {
+		return info
+	}
+	info.BlockIndependence = fd.Flags.BlockIndependence()
+	info.BlockChecksum = fd.Flags.BlockChecksum()
+	info.ContentChecksum = fd.Flags.ContentChecksum()
+	info.ContentSize = fd.ContentSize
+	info.DictID = fd.DictID
+	return info
+}
+
+// initFrame sets up the reading of the blocks of the frame whose headers were just read.
+func (r *Reader) initFrame() error {
+	if r.onFrame != nil {
+		r.onFrame(r.frameInfo())
+	}
+	r.num = r.conc
+	if !r.frame.Descriptor.Flags.BlockIndependence() || r.onBlock != nil {
+		// We can't decompress dependent blocks concurrently,
+		// nor report the blocks in order.
 		// Instead of throwing an error to the user, silently drop concurrency
+		// for this frame only.
 		r.num = 1
 	}
-	data, err := r.frame.InitR(r.src, r.num)
+	r.hist.Reset()
+	if r.frame.Descriptor.Flags.DictID() {
+		if r.resolve == nil {
+			return fmt.Errorf("%w: ID %#x", lz4errors.ErrDictionaryNotFound, r.frame.Descriptor.DictID)
+		}
+		dict, err := r.resolve(r.frame.Descriptor.DictID)
+		if err != nil {
+			return err
+		}
+		// The dictionary precedes the first block, or every block if they are independent.
+		r.hist.CopyUncompressed(dict)
+	}
+	data, err := r.frame.InitR(r.src, r.num, r.hist.Dict())
 	if err != nil {
 		return err
 	}
@@ -135,6 +207,11 @@ func (r *Reader) Read(buf []byte) (n int, err error) {
 				}
 				lz4block.Put(r.data)
 				r.data = nil
+				if err == io.EOF {
+					if err = r.nextFrame(); err == nil {
+						continue
+					}
+				}
 				return
 			default:
 				return
@@ -166,6 +243,11 @@ func (r *Reader) read(buf []byte) (int, error) {
 	if err != nil {
 		return 0, err
 	}
+	if r.onBlock != nil {
+		if err := r.onBlock(block.Data, block.Size.Uncompressed(), r.hist.Dict()); err != nil {
+			return 0, err
+		}
+	}
 	var direct bool
 	dst := r.data[:cap(r.data)]
 	if len(buf) >= len(dst) {
@@ -173,19 +255,12 @@ func (r *Reader) read(buf []byte) (int, error) {
 		direct = true
 		dst = buf
 	}
-	dst, err = block.Uncompress(r.frame, dst, r.dict, true)
+	dst, err = block.Uncompress(r.frame, dst, r.hist.Dict(), true)
 	if err != nil {
 		return 0, err
 	}
 	if !r.frame.Descriptor.Flags.BlockIndependence() {
-		if len(r.dict)+len(dst) > 128*1024 {
-			preserveSize := 64*1024 - len(dst)
-			if preserveSize < 0 {
-				preserveSize = 0
-			}
-			r.dict = r.dict[len(r.dict)-preserveSize:]
-		}
-		r.dict = append(r.dict, dst...)
+		r.hist.CopyUncompressed(dst)
 	}
 	r.cum += uint32(len(dst))
 	if direct {
@@ -207,6 +282,7 @@ func (r *Reader) Reset(reader io.Reader) {
 	r.state.reset()
 	r.src = reader
 	r.reads = nil
+	r.hist.Reset()
 }
 
 // WriteTo efficiently uncompresses the data from the Reader underlying source to w.
@@ -227,8 +303,8 @@ func (r *Reader) WriteTo(w io.Writer) (n int64, err error) {
 	if r.isNotConcurrent() {
 		size := r.frame.Descriptor.Flags.BlockSizeIndex()
 		data = size.Get()
-		defer lz4block.Put(data)
 	}
+	defer func() { lz4block.Put(data) }()
 	for {
 		var bn int
 		var dst []byte
@@ -247,8 +323,24 @@ func (r *Reader) WriteTo(w io.Writer) (n int64, err error) {
 		switch err {
 		case nil:
 		case io.EOF:
-			err = r.frame.CloseR(r.src)
-			return
+			if err = r.frame.CloseR(r.src); err != nil {
+				return
+			}
+			switch err = r.nextFrame(); err {
+			case nil:
+			case io.EOF:
+				err = nil
+				return
+			default:
+				return
+			}
+			if r.isNotConcurrent() {
+				// The block size may differ from the previous frame's.
+				lz4block.Put(data)
+				size := r.frame.Descriptor.Flags.BlockSizeIndex()
+				data = size.Get()
+			}
+			continue
 		default:
 			return
 		}
@@ -264,7 +356,7 @@ func (r *Reader) WriteTo(w io.Writer) (n int64, err error) {
 // ValidFrameHeader returns a bool indicating if the given bytes slice matches a LZ4 header.
 func ValidFrameHeader(in []byte) (bool, error) {
 	f := lz4stream.NewFrame()
-	err := f.ParseHeaders(bytes.NewReader(in))
+	err := f.ParseHeaders(bytes.NewReader(in), nil)
 	if err == nil {
 		return true, nil
 	}
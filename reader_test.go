@@ -71,6 +71,7 @@ func TestReader(t *testing.T) {
 			nil,
 			_o(lz4.ConcurrencyOption(-1)),
 		} {
+			opts := opts
 			fname := golden.name
 			isText := golden.isText
 			label := fmt.Sprintf("%s %v", fname, opts)
@@ -189,6 +190,150 @@ func TestWriteToBrokenWriter(t *testing.T) {
 	}
 }
 
+func TestReaderConcatenated(t *testing.T) {
+	a, b, c := pg1661[:100<<10], pg1661[100<<10:400<<10], pg1661[400<<10:]
+	zbuf := new(bytes.Buffer)
+	zw := lz4.NewWriter(zbuf)
+	_ = zw.Apply(lz4.BlockSizeOption(lz4.Block64Kb), lz4.SizeOption(uint64(len(a))))
+	if _, err := zw.Write(a); err != nil {
+		t.Fatal(err)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := zw.WriteSkippableFrame(0, []byte("between")); err != nil {
+		t.Fatal(err)
+	}
+	zw.Reset(zbuf)
+	_ = zw.Apply(
+		lz4.BlockSizeOption(lz4.Block256Kb),
+		lz4.BlockIndependenceOption(false),
+		lz4.BlockChecksumOption(true),
+		lz4.ChecksumOption(false),
+	)
+	if _, err := zw.Write(b); err != nil {
+		t.Fatal(err)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	// Concurrency is restored after the dependent blocks.
+	zw.Reset(zbuf)
+	_ = zw.Apply(lz4.BlockIndependenceOption(true))
+	if _, err := zw.Write(c); err != nil {
+		t.Fatal(err)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	frames := zbuf.Len()
+	// Zero padding at the end of the stream.
+	zbuf.Write(make([]byte, 7))
+
+	want := []lz4.FrameInfo{
+		{BlockSize: lz4.Block64Kb, BlockIndependence: true, ContentChecksum: true, ContentSize: uint64(len(a))},
+		{BlockSize: lz4.Block256Kb, BlockChecksum: true},
+		{BlockSize: lz4.Block256Kb, BlockIndependence: true, BlockChecksum: true},
+	}
+	for _, n := range []int{1, 4} {
+		for _, writeTo := range []bool{false, true} {
+			label := fmt.Sprintf("concurrency=%d WriteTo=%v", n, writeTo)
+			var infos []lz4.FrameInfo
+			zr := lz4.NewReader(bytes.NewReader(zbuf.Bytes()))
+			_ = zr.Apply(lz4.ConcurrencyOption(n), lz4.OnFrameOption(func(info lz4.FrameInfo) {
+				infos = append(infos, info)
+			}))
+			out := new(bytes.Buffer)
+			var err error
+			if writeTo {
+				_, err = zr.WriteTo(out)
+			} else {
+				_, err = io.Copy(out, struct{ io.Reader }{zr})
+			}
+			if err != nil {
+				t.Fatalf("%s: %v", label, err)
+			}
+			if !bytes.Equal(out.Bytes(), pg1661) {
+				t.Fatalf("%s: uncompressed data does not match original", label)
+			}
+			if !reflect.DeepEqual(infos, want) {
+				t.Fatalf("%s: got %+v; want %+v", label, infos, want)
+			}
+		}
+	}
+
+	// Only the first frame.
+	zr := lz4.NewReader(bytes.NewReader(zbuf.Bytes()))
+	_ = zr.Apply(lz4.ConcatenatedFramesOption(false))
+	out, err := ioutil.ReadAll(zr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(out, a) {
+		t.Fatal("uncompressed data does not match original")
+	}
+
+	// Padding must be made of zero bytes.
+	zbuf.Truncate(frames)
+	zbuf.Write([]byte{0, 0, 0, 0, 1})
+	if _, err := ioutil.ReadAll(lz4.NewReader(zbuf)); !errors.Is(err, lz4.ErrInvalidFrame) {
+		t.Fatalf("got %v; want %v", err, lz4.ErrInvalidFrame)
+	}
+}
+
+func TestReaderOnBlock(t *testing.T) {
+	zout := new(bytes.Buffer)
+	zw := lz4.NewWriter(zout)
+	_ = zw.Apply(lz4.BlockSizeOption(lz4.Block64Kb), lz4.BlockIndependenceOption(false))
+	if _, err := zw.Write(pg1661); err != nil {
+		t.Fatal(err)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	var blocks, size int
+	zr := lz4.NewReader(bytes.NewReader(zout.Bytes()))
+	_ = zr.Apply(lz4.ConcurrencyOption(4), lz4.OnBlockOption(func(block []byte, stored bool, dict []byte) error {
+		// Matches may reference the previous blocks.
+		want := size
+		if want > 64<<10 {
+			want = 64 << 10
+		}
+		if len(dict) != want {
+			t.Fatalf("block %d: got %d bytes of history; want %d", blocks, len(dict), want)
+		}
+		blocks++
+		if stored {
+			size += len(block)
+			return nil
+		}
+		s := lz4.NewSequenceScanner(block, len(dict))
+		for s.Scan() {
+		}
+		size += s.UncompressedSize()
+		return s.Err()
+	}))
+	out, err := ioutil.ReadAll(zr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(out, pg1661) {
+		t.Fatal("uncompressed data does not match original")
+	}
+	if want := (len(pg1661) + 64<<10 - 1) / (64 << 10); blocks != want || size != len(pg1661) {
+		t.Fatalf("got %d blocks of %d bytes; want %d blocks of %d bytes", blocks, size, want, len(pg1661))
+	}
+
+	// The handler errors are returned by the Reader.
+	errBlock := errors.New("block error")
+	zr = lz4.NewReader(bytes.NewReader(zout.Bytes()))
+	_ = zr.Apply(lz4.OnBlockOption(func([]byte, bool, []byte) error { return errBlock }))
+	if _, err := ioutil.ReadAll(zr); err != errBlock {
+		t.Fatalf("got %v; want %v", err, errBlock)
+	}
+}
+
 func TestReaderLegacy(t *testing.T) {
 	goldenFiles := []string{
 		"testdata/vmlinux_LZ4_19377.lz4",
@@ -203,6 +348,7 @@ func TestReaderLegacy(t *testing.T) {
 			label := fmt.Sprintf("%s %v", fname, opts)
 			t.Run(label, func(t *testing.T) {
 				fname := fname
+				opts := opts
 				t.Parallel()
 
 				var out bytes.Buffer
@@ -20,7 +20,7 @@ var writerStates = []aState{
 func NewWriter(w io.Writer) *Writer {
 	zw := &Writer{frame: lz4stream.NewFrame()}
 	zw.state.init(writerStates)
-	_ = zw.Apply(DefaultBlockSizeOption, DefaultChecksumOption, DefaultConcurrency, defaultOnBlockDone)
+	_ = zw.Apply(DefaultBlockSizeOption, DefaultChecksumOption, DefaultConcurrency, defaultOnBlockDone, defaultIndependence)
 	zw.Reset(w)
 	return zw
 }
@@ -28,14 +28,19 @@ func NewWriter(w io.Writer) *Writer {
 // Writer allows writing an LZ4 stream.
 type Writer struct {
 	state   _State
-	src     io.Writer                 // destination writer
-	level   lz4block.CompressionLevel // how hard to try
-	num     int                       // concurrency level
-	frame   *lz4stream.Frame          // frame being built
-	data    []byte                    // pending data
-	idx     int                       // size of pending data
+	src     io.Writer        // destination writer
+	params  lz4block.Params  // how to compress
+	num     int              // concurrency level
+	frame   *lz4stream.Frame // frame being built
+	data    []byte           // pending data
+	idx     int              // size of pending data
 	handler func(int)
 	legacy  bool
+	store   bool                        // store incompressible data without compressing it
+	linked  bool                        // blocks depend on the previous ones
+	hist    lz4block.StreamDecompressor // history of dependent blocks compressed concurrently
+	stream  lz4block.LinkedCompressor   // compressor of dependent blocks when not concurrent
+	dict    *lz4block.Dict              // dictionary identified in the frame descriptor
 }
 
 func (*Writer) private() {}
@@ -64,6 +69,16 @@ func (w *Writer) isNotConcurrent() bool {
 
 // init sets up the Writer when in newState. It does not change the Writer state.
 func (w *Writer) init() error {
+	w.linked = !w.legacy && !w.frame.Descriptor.Flags.BlockIndependence()
+	w.hist.Reset()
+	if w.dict != nil && w.linked {
+		// The dictionary precedes the first block.
+		w.hist.AddUncompressed(w.dict.Bytes())
+	}
+	if w.linked && w.isNotConcurrent() {
+		// The history is kept by the stream compressor instead.
+		w.stream.Reset(w.params, w.hist.Dict())
+	}
 	w.frame.InitW(w.src, w.num, w.legacy)
 	size := w.frame.Descriptor.Flags.BlockSizeIndex()
 	w.data = size.Get()
@@ -72,10 +87,11 @@ func (w *Writer) init() error {
 }
 
 func (w *Writer) Write(buf []byte) (n int, err error) {
-	defer w.state.check(&err)
 	switch w.state.state {
 	case writeState:
-	case closedState, errorState:
+	case closedState:
+		return 0, lz4errors.ErrWriterClosed
+	case errorState:
 		return 0, w.state.err
 	case newState:
 		if err = w.init(); w.state.next(err) {
@@ -84,6 +100,7 @@ func (w *Writer) Write(buf []byte) (n int, err error) {
 	default:
 		return 0, w.state.fail()
 	}
+	defer w.state.check(&err)
 
 	zn := len(w.data)
 	for len(buf) > 0 {
@@ -121,17 +138,46 @@ func (w *Writer) Write(buf []byte) (n int, err error) {
 }
 
 func (w *Writer) write(data []byte, safe bool) error {
+	params := w.params
+	// Legacy frames cannot store blocks uncompressed.
+	// The decision is made here so that it does not depend on concurrent compressions.
+	if w.store && !w.legacy && lz4block.EstimateRatio(data) >= rawRatio {
+		params.Store = true
+	}
 	if w.isNotConcurrent() {
 		block := w.frame.Blocks.Block
-		err := block.Compress(w.frame, data, w.level).Write(w.frame, w.src)
+		if w.linked {
+			block.CompressWith(w.frame, data, func(src, dst []byte) (int, error) {
+				return w.stream.CompressBlock(src, dst, params.Store)
+			})
+		} else {
+			w.compressIndependent(block, data, params)
+		}
+		err := block.Write(w.frame, w.src)
 		w.handler(len(block.Data))
 		return err
 	}
+	dict := w.hist.Dict()
+	if w.linked {
+		// The block is compressed with a copy of the window preceding it,
+		// as the history moves on with the next blocks.
+		if len(dict) > int(Block64Kb) {
+			dict = dict[len(dict)-int(Block64Kb):]
+		}
+		dict = append(lz4block.Index(lz4block.Block64Kb).Get()[:0], dict...)
+		w.hist.CopyUncompressed(data)
+	}
 	c := make(chan *lz4stream.FrameDataBlock)
 	w.frame.Blocks.Blocks <- c
-	go func(c chan *lz4stream.FrameDataBlock, data []byte, safe bool) {
+	go func(c chan *lz4stream.FrameDataBlock, data, dict []byte, safe bool) {
 		b := lz4stream.NewFrameDataBlock(w.frame)
-		c <- b.Compress(w.frame, data, w.level)
+		if w.linked {
+			b.Compress(w.frame, data, dict, params)
+			lz4block.Put(dict)
+		} else {
+			w.compressIndependent(b, data, params)
+		}
+		c <- b
 		<-c
 		w.handler(len(b.Data))
 		b.Close(w.frame)
@@ -139,11 +185,22 @@ func (w *Writer) write(data []byte, safe bool) error {
 			// safe to put it back as the last usage of it was FrameDataBlock.Write() called before c is closed
 			lz4block.Put(data)
 		}
-	}(c, data, safe)
+	}(c, data, dict, safe)
 
 	return nil
 }
 
+// compressIndependent compresses data into b with the prepared dictionary, if any.
+func (w *Writer) compressIndependent(b *lz4stream.FrameDataBlock, data []byte, params lz4block.Params) {
+	dict := w.dict
+	if w.legacy {
+		dict = nil
+	}
+	b.CompressWith(w.frame, data, func(src, dst []byte) (int, error) {
+		return params.CompressBlockWithPreparedDict(src, dst, dict)
+	})
+}
+
 // Flush any buffered data to the underlying writer immediately.
 func (w *Writer) Flush() (err error) {
 	switch w.state.state {
@@ -171,6 +228,9 @@ func (w *Writer) Flush() (err error) {
 // Close closes the Writer, flushing any unwritten data to the underlying writer
 // without closing it.
 func (w *Writer) Close() error {
+	if w.state.state == closedState {
+		return nil
+	}
 	if err := w.Flush(); err != nil {
 		return err
 	}
@@ -180,9 +240,32 @@ func (w *Writer) Close() error {
 		lz4block.Put(w.data)
 		w.data = nil
 	}
+	w.state.next(err)
 	return err
 }
 
+// WriteSkippableFrame writes a skippable frame with the given magic nibble (0-15) and payload
+// to the underlying writer. Such frames are ignored by decoders unless they handle them,
+// see OnSkippableFrameOption.
+//
+// It must be called either before the first Write, or after Close and before Reset,
+// so that the skippable frame precedes or follows the LZ4 frame.
+func (w *Writer) WriteSkippableFrame(nibble uint8, payload []byte) (err error) {
+	// An invalid frame is rejected without affecting the Writer.
+	if err := lz4stream.CheckSkippable(nibble, len(payload)); err != nil {
+		return err
+	}
+	switch w.state.state {
+	case newState, closedState:
+	case errorState:
+		return w.state.err
+	default:
+		return lz4errors.ErrWriterNotClosed
+	}
+	defer w.state.check(&err)
+	return lz4stream.WriteSkippable(w.src, nibble, payload)
+}
+
 // Reset clears the state of the Writer w such that it is equivalent to its
 // initial state from NewWriter, but instead writing to writer.
 // Reset keeps the previous options unless overwritten by the supplied ones.
@@ -192,13 +275,16 @@ func (w *Writer) Close() error {
 func (w *Writer) Reset(writer io.Writer) {
 	w.frame.Reset(w.num)
 	w.state.reset()
+	w.hist.Reset()
 	w.src = writer
 }
 
 // ReadFrom efficiently reads from r and compressed into the Writer destination.
 func (w *Writer) ReadFrom(r io.Reader) (n int64, err error) {
 	switch w.state.state {
-	case closedState, errorState:
+	case closedState:
+		return 0, lz4errors.ErrWriterClosed
+	case errorState:
 		return 0, w.state.err
 	case newState:
 		if err = w.init(); w.state.next(err) {
@@ -240,3 +326,7 @@ func (w *Writer) ReadFrom(r io.Reader) (n int64, err error) {
 	}
 	return
 }
+
+// rawRatio is the estimated compression ratio above which a block is stored
+// without trying to compress it.
+const rawRatio = 0.98
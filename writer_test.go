@@ -3,9 +3,12 @@ package lz4_test
 import (
 	"archive/tar"
 	"bytes"
+	"encoding/binary"
+	"errors"
 	"fmt"
 	"io"
 	"io/ioutil"
+	"math/rand"
 	"os"
 	"os/exec"
 	"reflect"
@@ -394,3 +397,304 @@ func TestWriterConcurrency(t *testing.T) {
 		t.Fatal(err)
 	}
 }
+
+func TestWriterOptions(t *testing.T) {
+	for _, opts := range [][]lz4.Option{
+		{lz4.AccelerationOption(8)},
+		{lz4.AccelerationOption(8), lz4.ConcurrencyOption(4), lz4.BlockSizeOption(lz4.Block64Kb)},
+		{lz4.HashLogOption(10)},
+		{lz4.HashLogOption(20), lz4.BlockSizeOption(lz4.Block64Kb)},
+		{lz4.MaxOffsetOption(4 << 10)},
+		{lz4.MaxOffsetOption(1 << 10), lz4.CompressionLevelOption(lz4.Level10)},
+		{lz4.FavorDecSpeedOption(true), lz4.CompressionLevelOption(lz4.Level10)},
+		{lz4.FavorDecSpeedOption(true), lz4.CompressionLevelOption(lz4.Level12)},
+		{lz4.CompressionLevelOption(lz4.Level10)},
+		{lz4.CompressionLevelOption(lz4.Level12), lz4.BlockSizeOption(lz4.Block64Kb)},
+		{lz4.CompressionLevelOption(lz4.Store)},
+		{lz4.BlockIndependenceOption(false), lz4.BlockSizeOption(lz4.Block64Kb)},
+		{lz4.BlockIndependenceOption(false), lz4.BlockSizeOption(lz4.Block64Kb), lz4.ConcurrencyOption(4)},
+		{lz4.BlockIndependenceOption(false), lz4.BlockSizeOption(lz4.Block64Kb), lz4.CompressionLevelOption(lz4.Level10)},
+		{lz4.StoreIncompressibleOption(true), lz4.BlockSizeOption(lz4.Block64Kb)},
+	} {
+		opts := opts
+		t.Run(fmt.Sprint(opts), func(t *testing.T) {
+			t.Parallel()
+
+			zout := new(bytes.Buffer)
+			zw := lz4.NewWriter(zout)
+			if err := zw.Apply(opts...); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := io.Copy(zw, bytes.NewReader(pg1661)); err != nil {
+				t.Fatal(err)
+			}
+			if err := zw.Close(); err != nil {
+				t.Fatal(err)
+			}
+
+			out := new(bytes.Buffer)
+			if _, err := io.Copy(out, lz4.NewReader(zout)); err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(out.Bytes(), pg1661) {
+				t.Fatal("uncompressed data does not match original")
+			}
+		})
+	}
+}
+
+// writeFrame compresses data into a frame of 64Kb blocks with the Writer options opts.
+func writeFrame(t *testing.T, data []byte, opts ...lz4.Option) []byte {
+	t.Helper()
+	zout := new(bytes.Buffer)
+	zw := lz4.NewWriter(zout)
+	if err := zw.Apply(append(opts, lz4.BlockSizeOption(lz4.Block64Kb))...); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := zw.Write(data); err != nil {
+		t.Fatal(err)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return zout.Bytes()
+}
+
+func TestWriterStoreIncompressible(t *testing.T) {
+	// Random data and text, by blocks of 64Kb.
+	random := make([]byte, 4<<16)
+	rand.New(rand.NewSource(1)).Read(random)
+	text := pg1661[:8<<16]
+	data := append(append(append([]byte(nil), random...), text...), random...)
+
+	// Storing the incompressible blocks without trying to compress them gives the same frame.
+	want := writeFrame(t, data, lz4.ChecksumOption(false))
+
+	for _, tc := range []struct {
+		name   string
+		opts   []lz4.Option
+		stored int
+		want   []byte // expected frame, if any
+	}{
+		{"store level", _o(lz4.CompressionLevelOption(lz4.Store)), 16, nil},
+		{"store incompressible", _o(lz4.StoreIncompressibleOption(true)), 8, want},
+		{"store incompressible concurrently", _o(lz4.StoreIncompressibleOption(true), lz4.ConcurrencyOption(4)), 8, want},
+		{"store incompressible linked", _o(lz4.StoreIncompressibleOption(true), lz4.BlockIndependenceOption(false)), 8, nil},
+		{"store incompressible linked HC", _o(lz4.StoreIncompressibleOption(true), lz4.BlockIndependenceOption(false), lz4.CompressionLevelOption(lz4.Level9)), 8, nil},
+	} {
+		zbuf := writeFrame(t, data, append(tc.opts, lz4.ChecksumOption(false))...)
+		out, err := ioutil.ReadAll(lz4.NewReader(bytes.NewReader(zbuf)))
+		if err != nil {
+			t.Fatalf("%s: %v", tc.name, err)
+		}
+		if !bytes.Equal(out, data) {
+			t.Fatalf("%s: uncompressed data does not match original", tc.name)
+		}
+		if tc.want != nil && !bytes.Equal(zbuf, tc.want) {
+			t.Errorf("%s: frame differs from the default one", tc.name)
+		}
+
+		var stored int
+		for zbuf := zbuf[7:]; ; {
+			size := binary.LittleEndian.Uint32(zbuf)
+			if size == 0 {
+				break
+			}
+			if size&(1<<31) != 0 {
+				stored++
+			}
+			zbuf = zbuf[4+size&^(1<<31):]
+		}
+		if stored != tc.stored {
+			t.Errorf("%s: got %d stored blocks; want %d", tc.name, stored, tc.stored)
+		}
+	}
+}
+
+func TestWriterBlockIndependence(t *testing.T) {
+	independent := writeFrame(t, pg1661)
+	linked := writeFrame(t, pg1661, lz4.BlockIndependenceOption(false))
+	if len(linked) >= len(independent) {
+		t.Errorf("dependent blocks: got %d bytes; want less than %d", len(linked), len(independent))
+	}
+	// Dependent blocks are flagged in the frame descriptor.
+	if flg := linked[4]; flg&0x20 != 0 {
+		t.Errorf("got frame flags %x; want dependent blocks", flg)
+	}
+
+	// Sequential compression keeps its tables from one block to the next, concurrent
+	// compression indexes the previous block again: both frames hold the same data.
+	for _, level := range []lz4.CompressionLevel{lz4.Fast, lz4.Level10, lz4.Store} {
+		for _, n := range []int{1, 4} {
+			zbuf := writeFrame(t, pg1661, lz4.BlockIndependenceOption(false), lz4.CompressionLevelOption(level), lz4.ConcurrencyOption(n))
+			out, err := ioutil.ReadAll(lz4.NewReader(bytes.NewReader(zbuf)))
+			if err != nil {
+				t.Fatalf("%s, concurrency %d: %v", level, n, err)
+			}
+			if !bytes.Equal(out, pg1661) {
+				t.Fatalf("%s, concurrency %d: uncompressed data does not match original", level, n)
+			}
+		}
+	}
+
+	// The CompressingReader produces the same frame.
+	zcomp := lz4.NewCompressingReader(ioutil.NopCloser(bytes.NewReader(pg1661)))
+	if err := zcomp.Apply(lz4.BlockIndependenceOption(false), lz4.BlockSizeOption(lz4.Block64Kb)); err != nil {
+		t.Fatal(err)
+	}
+	zout, err := ioutil.ReadAll(zcomp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(zout, linked) {
+		t.Error("CompressingReader and Writer outputs differ")
+	}
+
+	out, err := ioutil.ReadAll(lz4.NewReader(bytes.NewReader(linked)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(out, pg1661) {
+		t.Fatal("uncompressed data does not match original")
+	}
+}
+
+func TestWriterDictionary(t *testing.T) {
+	const id = 0x12345678
+	dict := pg1661[:64<<10]
+	data := pg1661[64<<10 : 320<<10]
+	resolve := func(got uint32) ([]byte, error) {
+		if got != id {
+			return nil, fmt.Errorf("got dictionary ID %x; want %x", got, id)
+		}
+		return dict, nil
+	}
+
+	for _, independent := range []bool{true, false} {
+		for _, n := range []int{1, 4} {
+			opts := []lz4.Option{lz4.BlockIndependenceOption(independent), lz4.ConcurrencyOption(n)}
+			zbuf := writeFrame(t, data, append(opts, lz4.DictionaryOption(id, dict))...)
+			label := fmt.Sprintf("independent=%v concurrency=%d", independent, n)
+
+			// The dictionary ID follows the FLG and BD bytes.
+			if zbuf[4]&1 == 0 || binary.LittleEndian.Uint32(zbuf[6:]) != id {
+				t.Errorf("%s: no dictionary ID in frame descriptor", label)
+			}
+			if without := writeFrame(t, data, opts...); len(zbuf) >= len(without) {
+				t.Errorf("%s: got %d bytes; want less than %d", label, len(zbuf), len(without))
+			}
+
+			for _, m := range []int{1, 4} {
+				zr := lz4.NewReader(bytes.NewReader(zbuf))
+				if err := zr.Apply(lz4.DictionaryResolverOption(resolve), lz4.ConcurrencyOption(m)); err != nil {
+					t.Fatal(err)
+				}
+				out, err := ioutil.ReadAll(zr)
+				if err != nil {
+					t.Fatalf("%s: %v", label, err)
+				}
+				if !bytes.Equal(out, data) {
+					t.Fatalf("%s: uncompressed data does not match original", label)
+				}
+			}
+
+			// The dictionary is required, and its ID is reported.
+			_, err := ioutil.ReadAll(lz4.NewReader(bytes.NewReader(zbuf)))
+			if !errors.Is(err, lz4.ErrDictionaryNotFound) || !strings.Contains(err.Error(), "0x12345678") {
+				t.Errorf("%s: got %v; want %v", label, err, lz4.ErrDictionaryNotFound)
+			}
+		}
+	}
+
+	// Legacy frames do not use the dictionary.
+	zbuf := writeFrame(t, data, lz4.LegacyOption(true), lz4.DictionaryOption(id, dict))
+	if out, err := ioutil.ReadAll(lz4.NewReader(bytes.NewReader(zbuf))); err != nil || !bytes.Equal(out, data) {
+		t.Errorf("legacy: uncompressed data does not match original (%v)", err)
+	}
+
+	// The CompressingReader produces the same frame.
+	zcomp := lz4.NewCompressingReader(ioutil.NopCloser(bytes.NewReader(data)))
+	if err := zcomp.Apply(lz4.DictionaryOption(id, dict), lz4.BlockSizeOption(lz4.Block64Kb)); err != nil {
+		t.Fatal(err)
+	}
+	zout, err := ioutil.ReadAll(zcomp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(zout, writeFrame(t, data, lz4.DictionaryOption(id, dict))) {
+		t.Error("CompressingReader and Writer outputs differ")
+	}
+}
+
+func TestWriterSkippableFrame(t *testing.T) {
+	data := pg1661[:100<<10]
+	zout := new(bytes.Buffer)
+	zw := lz4.NewWriter(zout)
+	// An invalid frame leaves the Writer usable.
+	if err := zw.WriteSkippableFrame(16, nil); !errors.Is(err, lz4.ErrInvalidSkippableFrame) {
+		t.Fatalf("got %v; want %v", err, lz4.ErrInvalidSkippableFrame)
+	}
+	if err := zw.WriteSkippableFrame(0, []byte("provenance")); err != nil {
+		t.Fatal(err)
+	}
+	if err := zw.WriteSkippableFrame(0xF, []byte("unread")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := zw.Write(data); err != nil {
+		t.Fatal(err)
+	}
+	if err := zw.WriteSkippableFrame(1, nil); !errors.Is(err, lz4.ErrWriterNotClosed) {
+		t.Fatalf("got %v; want %v", err, lz4.ErrWriterNotClosed)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := zw.Write(data); !errors.Is(err, lz4.ErrWriterClosed) {
+		t.Fatalf("got %v; want %v", err, lz4.ErrWriterClosed)
+	}
+	if err := zw.WriteSkippableFrame(2, []byte("trailer")); err != nil {
+		t.Fatal(err)
+	}
+	// Closing again does not write anything.
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	zbuf := zout.Bytes()
+	if got, want := zbuf[len(zbuf)-15:], []byte("\x52\x2a\x4d\x18\x07\x00\x00\x00trailer"); !bytes.Equal(got, want) {
+		t.Fatalf("got %q; want %q", got, want)
+	}
+
+	var frames []string
+	zr := lz4.NewReader(bytes.NewReader(zbuf))
+	err := zr.Apply(lz4.OnSkippableFrameOption(func(nibble uint8, payload io.Reader) error {
+		if nibble == 0xF {
+			// Leave the payload for the Reader to discard.
+			frames = append(frames, fmt.Sprintf("%d", nibble))
+			return nil
+		}
+		buf, err := ioutil.ReadAll(payload)
+		frames = append(frames, fmt.Sprintf("%d:%s", nibble, buf))
+		return err
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	out, err := ioutil.ReadAll(zr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(out, data) {
+		t.Fatal("uncompressed data does not match original")
+	}
+	if got, want := strings.Join(frames, ","), "0:provenance,15,2:trailer"; got != want {
+		t.Fatalf("got %q; want %q", got, want)
+	}
+
+	// Errors from the handler are returned by the Reader.
+	errSkip := errors.New("skippable frame")
+	zr = lz4.NewReader(bytes.NewReader(zbuf))
+	_ = zr.Apply(lz4.OnSkippableFrameOption(func(uint8, io.Reader) error { return errSkip }))
+	if _, err := ioutil.ReadAll(zr); !errors.Is(err, errSkip) {
+		t.Fatalf("got %v; want %v", err, errSkip)
+	}
+}